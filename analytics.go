@@ -0,0 +1,86 @@
+package fcm
+
+import (
+	"regexp"
+
+	messaging "firebase.google.com/go/v4/messaging"
+)
+
+const (
+	// MAX_ANALYTICS_LABEL_LENGTH the longest analytics label FCM accepts
+	MAX_ANALYTICS_LABEL_LENGTH = 50
+)
+
+var (
+	// analyticsLabelPattern analytics labels FCM accepts
+	analyticsLabelPattern = regexp.MustCompile("^[a-zA-Z0-9-_.~%]{1,50}$")
+	// analyticsLabelInvalidChars characters replaced in derived labels
+	analyticsLabelInvalidChars = regexp.MustCompile("[^a-zA-Z0-9-_.~%]")
+)
+
+// SetAnalyticsLabel sets the label FCM aggregates the delivery data of
+// the message by, e.g. "catch_liked". Without a label the item_type of
+// the data is used.
+func (this *FcmClient) SetAnalyticsLabel(label string) *FcmClient {
+	this.Message.AnalyticsLabel = label
+
+	return this
+}
+
+// analyticsLabel the label of the message, derived from its item type
+// when not set
+func (this *FcmMsg) analyticsLabel() string {
+	if this.AnalyticsLabel != "" {
+		return this.AnalyticsLabel
+	}
+
+	var itemType string
+	switch data := this.Data.(type) {
+	case *AppData:
+		itemType = string(data.ItemType)
+	case AppData:
+		itemType = string(data.ItemType)
+	case map[string]interface{}:
+		itemType, _ = data["item_type"].(string)
+	case map[string]string:
+		itemType = data["item_type"]
+	}
+
+	label := analyticsLabelInvalidChars.ReplaceAllString(itemType, "_")
+	if len(label) > MAX_ANALYTICS_LABEL_LENGTH {
+		label = label[:MAX_ANALYTICS_LABEL_LENGTH]
+	}
+
+	return label
+}
+
+// applyAnalyticsLabel sets the label on the message and the Android and
+// APNs configs. Web push has no label of its own and uses the message one.
+func (this *FcmMsg) applyAnalyticsLabel(message *messaging.MulticastMessage) {
+	label := this.analyticsLabel()
+	if label == "" {
+		return
+	}
+
+	message.FCMOptions = &messaging.FCMOptions{AnalyticsLabel: label}
+
+	if message.Android == nil {
+		message.Android = &messaging.AndroidConfig{}
+	}
+	message.Android.FCMOptions = &messaging.AndroidFCMOptions{AnalyticsLabel: label}
+
+	if message.APNS == nil {
+		message.APNS = &messaging.APNSConfig{}
+	}
+	if message.APNS.FCMOptions == nil {
+		message.APNS.FCMOptions = &messaging.APNSFCMOptions{}
+	}
+	message.APNS.FCMOptions.AnalyticsLabel = label
+}
+
+// validateAnalyticsLabel checks the label set on the message
+func (this *FcmMsg) validateAnalyticsLabel(v *validator) {
+	if this.AnalyticsLabel != "" && !analyticsLabelPattern.MatchString(this.AnalyticsLabel) {
+		v.add("analytics_label", "must be at most %d characters of [a-zA-Z0-9-_.~%%], got %q", MAX_ANALYTICS_LABEL_LENGTH, this.AnalyticsLabel)
+	}
+}
@@ -0,0 +1,52 @@
+package fcm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyticsLabel_SetOnEveryPlatform(t *testing.T) {
+	c := NewFcmClient("key").
+		NewFcmRegIdsMsg([]string{"token0"}, nil).
+		SetNotificationPayload(&NotificationPayload{Title: "title", Image: "https://example.com/img.jpg"}).
+		SetAnalyticsLabel("catch_liked")
+	require.Nil(t, c.Validate())
+
+	message, err := c.Message.makeMulticastMessage()
+	require.Nil(t, err)
+	require.Equal(t, "catch_liked", message.FCMOptions.AnalyticsLabel)
+	require.Equal(t, "catch_liked", message.Android.FCMOptions.AnalyticsLabel)
+	require.Equal(t, "catch_liked", message.APNS.FCMOptions.AnalyticsLabel)
+	// the APNs image is kept
+	require.Equal(t, "https://example.com/img.jpg", message.APNS.FCMOptions.ImageURL)
+}
+
+func TestAnalyticsLabel_DerivedFromItemType(t *testing.T) {
+	msg := FcmMsg{RegistrationIds: []string{"token0"}, Data: map[string]interface{}{"item_type": "Post"}}
+
+	message, err := msg.makeMulticastMessage()
+	require.Nil(t, err)
+	require.Equal(t, "Post", message.FCMOptions.AnalyticsLabel)
+	require.Equal(t, "Post", message.APNS.FCMOptions.AnalyticsLabel)
+
+	msg.Data = &AppData{ItemType: ItemType("Fishing Trip/" + strings.Repeat("x", 60))}
+	require.Equal(t, "Fishing_Trip_"+strings.Repeat("x", 37), msg.analyticsLabel())
+
+	// no item type, no label
+	msg.Data = nil
+	message, err = msg.makeMulticastMessage()
+	require.Nil(t, err)
+	require.Nil(t, message.FCMOptions)
+}
+
+func TestAnalyticsLabel_Validate(t *testing.T) {
+	for _, label := range []string{"catch liked", "catch/liked", strings.Repeat("x", 51)} {
+		msg := FcmMsg{RegistrationIds: []string{"token0"}, AnalyticsLabel: label}
+		require.Equal(t, []string{"analytics_label"}, validationFields(t, msg.Validate()), label)
+	}
+
+	msg := FcmMsg{RegistrationIds: []string{"token0"}, AnalyticsLabel: "catch-liked_v2.1~%20"}
+	require.Nil(t, msg.Validate())
+}
@@ -0,0 +1,249 @@
+package fcm
+
+import (
+	"regexp"
+	"time"
+
+	messaging "firebase.google.com/go/v4/messaging"
+)
+
+// AndroidVisibility how much of the notification shows on the lock screen
+type AndroidVisibility string
+
+const (
+	// AndroidVisibility_PRIVATE shown, hiding sensitive content on secure lock screens
+	AndroidVisibility_PRIVATE AndroidVisibility = "private"
+	// AndroidVisibility_PUBLIC shown in full on every lock screen
+	AndroidVisibility_PUBLIC AndroidVisibility = "public"
+	// AndroidVisibility_SECRET not shown on secure lock screens
+	AndroidVisibility_SECRET AndroidVisibility = "secret"
+)
+
+// AndroidPriority the priority of the notification on the device, before
+// Android 8 (later versions use the channel importance)
+type AndroidPriority string
+
+const (
+	// AndroidPriority_MIN may only show in detailed notification logs
+	AndroidPriority_MIN AndroidPriority = "min"
+	// AndroidPriority_LOW may be shown smaller or lower in the list
+	AndroidPriority_LOW AndroidPriority = "low"
+	// AndroidPriority_DEFAULT the default priority
+	AndroidPriority_DEFAULT AndroidPriority = "default"
+	// AndroidPriority_HIGH may be shown larger or higher in the list
+	AndroidPriority_HIGH AndroidPriority = "high"
+	// AndroidPriority_MAX needs the prompt attention of the user
+	AndroidPriority_MAX AndroidPriority = "max"
+)
+
+var (
+	// lightColorPattern LED colours, #rrggbb or #rrggbbaa
+	lightColorPattern = regexp.MustCompile("^#[0-9a-fA-F]{6}([0-9a-fA-F]{2})?$")
+
+	androidVisibilities = map[AndroidVisibility]messaging.AndroidNotificationVisibility{
+		AndroidVisibility_PRIVATE: messaging.VisibilityPrivate,
+		AndroidVisibility_PUBLIC:  messaging.VisibilityPublic,
+		AndroidVisibility_SECRET:  messaging.VisibilitySecret,
+	}
+
+	androidPriorities = map[AndroidPriority]messaging.AndroidNotificationPriority{
+		AndroidPriority_MIN:     messaging.PriorityMin,
+		AndroidPriority_LOW:     messaging.PriorityLow,
+		AndroidPriority_DEFAULT: messaging.PriorityDefault,
+		AndroidPriority_HIGH:    messaging.PriorityHigh,
+		AndroidPriority_MAX:     messaging.PriorityMax,
+	}
+)
+
+// AndroidLight the notification LED settings
+type AndroidLight struct {
+	// Color #rrggbb or #rrggbbaa
+	Color             string `json:"color"`
+	OnDurationMillis  int64  `json:"on_duration_millis"`
+	OffDurationMillis int64  `json:"off_duration_millis"`
+}
+
+// AndroidOptions Android specific notification fields, built with the
+// chainable setters, e.g. NewAndroidOptions().SetSticky(true)
+type AndroidOptions struct {
+	Visibility AndroidVisibility `json:"visibility,omitempty"`
+	Priority   AndroidPriority   `json:"priority,omitempty"`
+	// VibrateTimingMillis alternating off and on durations, starting with off
+	VibrateTimingMillis   []int64       `json:"vibrate_timing_millis,omitempty"`
+	DefaultVibrateTimings bool          `json:"default_vibrate_timings,omitempty"`
+	DefaultSound          bool          `json:"default_sound,omitempty"`
+	Light                 *AndroidLight `json:"light,omitempty"`
+	DefaultLightSettings  bool          `json:"default_light_settings,omitempty"`
+	// Sticky the notification stays when tapped
+	Sticky         bool       `json:"sticky,omitempty"`
+	EventTimestamp *time.Time `json:"event_timestamp,omitempty"`
+	// LocalOnly the notification isn't bridged to other devices, e.g. watches
+	LocalOnly         bool `json:"local_only,omitempty"`
+	NotificationCount *int `json:"notification_count,omitempty"`
+}
+
+// NewAndroidOptions creates empty Android options
+func NewAndroidOptions() *AndroidOptions {
+	return &AndroidOptions{}
+}
+
+// SetVisibility sets the lock screen visibility
+func (this *AndroidOptions) SetVisibility(visibility AndroidVisibility) *AndroidOptions {
+	this.Visibility = visibility
+
+	return this
+}
+
+// SetPriority sets the notification priority
+func (this *AndroidOptions) SetPriority(priority AndroidPriority) *AndroidOptions {
+	this.Priority = priority
+
+	return this
+}
+
+// SetVibration sets the vibration pattern, alternating off and on durations
+func (this *AndroidOptions) SetVibration(timings ...time.Duration) *AndroidOptions {
+	this.VibrateTimingMillis = make([]int64, 0, len(timings))
+	for _, timing := range timings {
+		this.VibrateTimingMillis = append(this.VibrateTimingMillis, timing.Milliseconds())
+	}
+
+	return this
+}
+
+// SetDefaultVibration uses the default vibration pattern of the device
+func (this *AndroidOptions) SetDefaultVibration(enabled bool) *AndroidOptions {
+	this.DefaultVibrateTimings = enabled
+
+	return this
+}
+
+// SetDefaultSound uses the default notification sound of the device
+func (this *AndroidOptions) SetDefaultSound(enabled bool) *AndroidOptions {
+	this.DefaultSound = enabled
+
+	return this
+}
+
+// SetLight sets the LED colour (#rrggbb or #rrggbbaa) and blink rate
+func (this *AndroidOptions) SetLight(color string, on time.Duration, off time.Duration) *AndroidOptions {
+	this.Light = &AndroidLight{
+		Color:             color,
+		OnDurationMillis:  on.Milliseconds(),
+		OffDurationMillis: off.Milliseconds(),
+	}
+
+	return this
+}
+
+// SetDefaultLight uses the default LED settings of the device
+func (this *AndroidOptions) SetDefaultLight(enabled bool) *AndroidOptions {
+	this.DefaultLightSettings = enabled
+
+	return this
+}
+
+// SetSticky keeps the notification when tapped
+func (this *AndroidOptions) SetSticky(sticky bool) *AndroidOptions {
+	this.Sticky = sticky
+
+	return this
+}
+
+// SetEventTimestamp sets the time of the event the notification is about
+func (this *AndroidOptions) SetEventTimestamp(timestamp time.Time) *AndroidOptions {
+	this.EventTimestamp = &timestamp
+
+	return this
+}
+
+// SetLocalOnly keeps the notification off bridged devices
+func (this *AndroidOptions) SetLocalOnly(localOnly bool) *AndroidOptions {
+	this.LocalOnly = localOnly
+
+	return this
+}
+
+// SetNotificationCount sets the count shown on the launcher icon
+func (this *AndroidOptions) SetNotificationCount(count int) *AndroidOptions {
+	this.NotificationCount = &count
+
+	return this
+}
+
+// SetAndroidOptions sets the Android specific notification fields
+func (this *FcmClient) SetAndroidOptions(options *AndroidOptions) *FcmClient {
+	this.Message.Android = options
+
+	return this
+}
+
+// applyAndroid sets the options on the Android notification
+func (this *AndroidOptions) applyAndroid(notification *messaging.AndroidNotification) {
+	if visibility, ok := androidVisibilities[this.Visibility]; ok {
+		notification.Visibility = visibility
+	}
+	if priority, ok := androidPriorities[this.Priority]; ok {
+		notification.Priority = priority
+	}
+
+	if len(this.VibrateTimingMillis) > 0 {
+		notification.VibrateTimingMillis = this.VibrateTimingMillis
+	}
+	notification.DefaultVibrateTimings = notification.DefaultVibrateTimings || this.DefaultVibrateTimings
+	notification.DefaultSound = notification.DefaultSound || this.DefaultSound
+
+	if this.Light != nil {
+		notification.LightSettings = &messaging.LightSettings{
+			Color:                  this.Light.Color,
+			LightOnDurationMillis:  this.Light.OnDurationMillis,
+			LightOffDurationMillis: this.Light.OffDurationMillis,
+		}
+	}
+	notification.DefaultLightSettings = notification.DefaultLightSettings || this.DefaultLightSettings
+
+	notification.Sticky = this.Sticky
+	notification.EventTimestamp = this.EventTimestamp
+	notification.LocalOnly = this.LocalOnly
+	if this.NotificationCount != nil {
+		notification.NotificationCount = this.NotificationCount
+	}
+}
+
+// validate checks the enum values, vibration pattern and LED settings
+func (this *AndroidOptions) validate(v *validator, path string) {
+	if _, ok := androidVisibilities[this.Visibility]; this.Visibility != "" && !ok {
+		v.add(path+".visibility", "unknown visibility %q, expected %q, %q or %q", this.Visibility,
+			AndroidVisibility_PRIVATE, AndroidVisibility_PUBLIC, AndroidVisibility_SECRET)
+	}
+	if _, ok := androidPriorities[this.Priority]; this.Priority != "" && !ok {
+		v.add(path+".priority", "unknown priority %q, expected %q, %q, %q, %q or %q", this.Priority,
+			AndroidPriority_MIN, AndroidPriority_LOW, AndroidPriority_DEFAULT, AndroidPriority_HIGH, AndroidPriority_MAX)
+	}
+
+	for _, timing := range this.VibrateTimingMillis {
+		if timing < 0 {
+			v.add(path+".vibrate_timing_millis", "timings must not be negative, got %d", timing)
+			break
+		}
+	}
+	if len(this.VibrateTimingMillis) > 0 && this.DefaultVibrateTimings {
+		v.add(path+".vibrate_timing_millis", "can't be combined with default_vibrate_timings")
+	}
+
+	if this.Light != nil {
+		if !lightColorPattern.MatchString(this.Light.Color) {
+			v.add(path+".light.color", "must be in #rrggbb or #rrggbbaa format, got %q", this.Light.Color)
+		}
+		if this.Light.OnDurationMillis < 0 || this.Light.OffDurationMillis < 0 {
+			v.add(path+".light", "durations must not be negative")
+		}
+		if this.DefaultLightSettings {
+			v.add(path+".light", "can't be combined with default_light_settings")
+		}
+	}
+
+	if this.NotificationCount != nil && *this.NotificationCount < 0 {
+		v.add(path+".notification_count", "must not be negative, got %d", *this.NotificationCount)
+	}
+}
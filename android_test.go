@@ -0,0 +1,69 @@
+package fcm
+
+import (
+	"testing"
+	"time"
+
+	messaging "firebase.google.com/go/v4/messaging"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAndroidOptions_Applied(t *testing.T) {
+	eventTime := time.Date(2024, 6, 1, 5, 30, 0, 0, time.UTC)
+	c := NewFcmClient("key").
+		NewFcmRegIdsMsg([]string{"token0"}, nil).
+		SetNotificationPayload(&NotificationPayload{Title: "Storm warning"}).
+		SetAndroidOptions(NewAndroidOptions().
+			SetVisibility(AndroidVisibility_PUBLIC).
+			SetPriority(AndroidPriority_MAX).
+			SetVibration(0, 500*time.Millisecond, 200*time.Millisecond, 500*time.Millisecond).
+			SetLight("#ff0000", time.Second, 500*time.Millisecond).
+			SetSticky(true).
+			SetEventTimestamp(eventTime).
+			SetLocalOnly(true).
+			SetDefaultSound(true).
+			SetNotificationCount(3))
+	require.Nil(t, c.Validate())
+
+	message, err := c.Message.makeMulticastMessage()
+	require.Nil(t, err)
+
+	notification := message.Android.Notification
+	require.Equal(t, messaging.VisibilityPublic, notification.Visibility)
+	require.Equal(t, messaging.PriorityMax, notification.Priority)
+	require.Equal(t, []int64{0, 500, 200, 500}, notification.VibrateTimingMillis)
+	require.Equal(t, &messaging.LightSettings{Color: "#ff0000", LightOnDurationMillis: 1000, LightOffDurationMillis: 500}, notification.LightSettings)
+	require.True(t, notification.Sticky)
+	require.True(t, notification.LocalOnly)
+	require.True(t, notification.DefaultSound)
+	require.Equal(t, eventTime, *notification.EventTimestamp)
+	require.Equal(t, 3, *notification.NotificationCount)
+}
+
+func TestAndroidOptions_Validate(t *testing.T) {
+	count := -1
+	msg := FcmMsg{
+		RegistrationIds: []string{"token0"},
+		Android: &AndroidOptions{
+			Visibility:            "hidden",
+			Priority:              "urgent",
+			VibrateTimingMillis:   []int64{0, -100},
+			DefaultVibrateTimings: true,
+			Light:                 &AndroidLight{Color: "red", OnDurationMillis: -1},
+			NotificationCount:     &count,
+		},
+	}
+
+	require.Equal(t, []string{
+		"android.visibility",
+		"android.priority",
+		"android.vibrate_timing_millis",
+		"android.vibrate_timing_millis",
+		"android.light.color",
+		"android.light",
+		"android.notification_count",
+	}, validationFields(t, msg.Validate()))
+
+	msg.Android = NewAndroidOptions().SetLight("#ff000080", time.Second, time.Second)
+	require.Nil(t, msg.Validate())
+}
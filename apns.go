@@ -0,0 +1,101 @@
+package fcm
+
+import (
+	messaging "firebase.google.com/go/v4/messaging"
+)
+
+// InterruptionLevel how an iOS 15+ notification interrupts the user
+type InterruptionLevel string
+
+const (
+	// InterruptionLevel_PASSIVE added to the notification list without lighting up the screen
+	InterruptionLevel_PASSIVE InterruptionLevel = "passive"
+	// InterruptionLevel_ACTIVE the default, shown right away
+	InterruptionLevel_ACTIVE InterruptionLevel = "active"
+	// InterruptionLevel_TIME_SENSITIVE shown right away, breaking through
+	// Focus and kept out of the notification summary
+	InterruptionLevel_TIME_SENSITIVE InterruptionLevel = "time-sensitive"
+	// InterruptionLevel_CRITICAL breaks through mute and Do Not Disturb,
+	// needs EnableCriticalAlerts
+	InterruptionLevel_CRITICAL InterruptionLevel = "critical"
+)
+
+const (
+	// aps_interruption_level aps keys the SDK has no fields for
+	aps_interruption_level = "interruption-level"
+	aps_relevance_score    = "relevance-score"
+	aps_target_content_id  = "target-content-id"
+)
+
+// APNSOptions iOS specific notification fields
+type APNSOptions struct {
+	Subtitle string `json:"subtitle,omitempty"`
+	// ThreadID groups the notifications of a thread, e.g. a catch's comments
+	ThreadID string `json:"thread_id,omitempty"`
+	// TargetContentID the window brought forward when the notification is opened
+	TargetContentID   string            `json:"target_content_id,omitempty"`
+	InterruptionLevel InterruptionLevel `json:"interruption_level,omitempty"`
+	// RelevanceScore ranks the notification in the summary, between 0 and 1
+	RelevanceScore *float64 `json:"relevance_score,omitempty"`
+}
+
+// SetAPNSOptions sets the iOS specific notification fields
+func (this *FcmClient) SetAPNSOptions(options *APNSOptions) *FcmClient {
+	this.Message.APNS = options
+
+	return this
+}
+
+// SetInterruptionLevel sets the iOS interruption level of the notification
+func (this *FcmClient) SetInterruptionLevel(level InterruptionLevel) *FcmClient {
+	if this.Message.APNS == nil {
+		this.Message.APNS = &APNSOptions{}
+	}
+	this.Message.APNS.InterruptionLevel = level
+
+	return this
+}
+
+// applyAPNS sets the iOS fields on the aps dictionary
+func (this *APNSOptions) applyAPNS(aps *messaging.Aps) {
+	if this.Subtitle != "" {
+		if aps.Alert == nil {
+			aps.Alert = &messaging.ApsAlert{}
+		}
+		aps.Alert.SubTitle = this.Subtitle
+	}
+
+	if this.ThreadID != "" {
+		aps.ThreadID = this.ThreadID
+	}
+
+	setCustom := func(key string, value interface{}) {
+		if aps.CustomData == nil {
+			aps.CustomData = make(map[string]interface{})
+		}
+		aps.CustomData[key] = value
+	}
+	if this.InterruptionLevel != "" {
+		setCustom(aps_interruption_level, string(this.InterruptionLevel))
+	}
+	if this.RelevanceScore != nil {
+		setCustom(aps_relevance_score, *this.RelevanceScore)
+	}
+	if this.TargetContentID != "" {
+		setCustom(aps_target_content_id, this.TargetContentID)
+	}
+}
+
+// validate checks the interruption level and relevance score
+func (this *APNSOptions) validate(v *validator, path string) {
+	switch this.InterruptionLevel {
+	case "", InterruptionLevel_PASSIVE, InterruptionLevel_ACTIVE, InterruptionLevel_TIME_SENSITIVE, InterruptionLevel_CRITICAL:
+	default:
+		v.add(path+".interruption_level", "unknown interruption level %q, expected %q, %q, %q or %q", this.InterruptionLevel,
+			InterruptionLevel_PASSIVE, InterruptionLevel_ACTIVE, InterruptionLevel_TIME_SENSITIVE, InterruptionLevel_CRITICAL)
+	}
+
+	if this.RelevanceScore != nil && (*this.RelevanceScore < 0 || *this.RelevanceScore > 1) {
+		v.add(path+".relevance_score", "must be between 0 and 1, got %v", *this.RelevanceScore)
+	}
+}
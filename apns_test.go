@@ -0,0 +1,62 @@
+package fcm
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPNSOptions_Applied(t *testing.T) {
+	relevance := 0.9
+	c := NewFcmClient("key").
+		NewFcmRegIdsMsg([]string{"token0"}, nil).
+		SetNotificationPayload(&NotificationPayload{Title: "Pike caught nearby", Badge: "2"}).
+		SetAPNSOptions(&APNSOptions{
+			Subtitle:          "Lake Vättern",
+			ThreadID:          "catches-nearby",
+			TargetContentID:   "catch-42",
+			InterruptionLevel: InterruptionLevel_TIME_SENSITIVE,
+			RelevanceScore:    &relevance,
+		})
+	require.Nil(t, c.Validate())
+
+	message, err := c.Message.makeMulticastMessage()
+	require.Nil(t, err)
+
+	encoded, err := json.Marshal(message.APNS.Payload.Aps)
+	require.Nil(t, err)
+	require.JSONEq(t, `{
+		"alert": {"title": "Pike caught nearby", "subtitle": "Lake Vättern"},
+		"badge": 2,
+		"thread-id": "catches-nearby",
+		"target-content-id": "catch-42",
+		"interruption-level": "time-sensitive",
+		"relevance-score": 0.9
+	}`, string(encoded))
+}
+
+func TestAPNSOptions_Validate(t *testing.T) {
+	relevance := 1.5
+	msg := FcmMsg{
+		RegistrationIds: []string{"token0"},
+		APNS:            &APNSOptions{InterruptionLevel: "urgent", RelevanceScore: &relevance},
+	}
+
+	require.Equal(t, []string{"apns.interruption_level", "apns.relevance_score"}, validationFields(t, msg.Validate()))
+}
+
+func TestAPNSOptions_CriticalLevelNeedsOptIn(t *testing.T) {
+	c := NewFcmClient("key").
+		SetMessagingClient(new(fcmMock)).
+		NewFcmRegIdsMsg([]string{"token0"}, nil).
+		SetNotificationPayload(&NotificationPayload{Title: "Storm warning"}).
+		SetInterruptionLevel(InterruptionLevel_CRITICAL)
+
+	_, err := c.Send()
+	require.True(t, errors.Is(err, ErrCriticalAlertsDisabled))
+	require.Equal(t, []string{"apns.interruption_level"}, validationFields(t, c.Validate()))
+
+	require.Nil(t, c.EnableCriticalAlerts(true).Validate())
+}
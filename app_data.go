@@ -0,0 +1,160 @@
+package fcm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// ItemType the kind of item a notification is about
+type ItemType string
+
+const (
+	// ItemType_POST a post
+	ItemType_POST ItemType = "Post"
+	// ItemType_CATCH a logged catch
+	ItemType_CATCH ItemType = "Catch"
+	// ItemType_COMMENT a comment on a post or catch
+	ItemType_COMMENT ItemType = "Comment"
+	// ItemType_USER a user profile
+	ItemType_USER ItemType = "User"
+)
+
+// Action an action the app offers with the notification, e.g. {Like, like}
+type Action struct {
+	Type     string `json:"type"`
+	Value    string `json:"value"`
+	DeepLink string `json:"deeplink,omitempty"`
+	// Foreground the action opens the app
+	Foreground bool `json:"foreground,omitempty"`
+	// Destructive the action is shown as destructive (iOS)
+	Destructive bool `json:"destructive,omitempty"`
+}
+
+// TrackingPayload analytics attribution of the notification
+type TrackingPayload struct {
+	Campaign   string            `json:"campaign,omitempty"`
+	Source     string            `json:"source,omitempty"`
+	Medium     string            `json:"medium,omitempty"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// AppData the data payload contract between the backend and the apps.
+// The json tags are the data keys, so an AppData stored as JSON (e.g. in
+// an outbox) is sent unchanged.
+type AppData struct {
+	Title           string           `json:"title,omitempty"`
+	Body            string           `json:"body,omitempty"`
+	ItemType        ItemType         `json:"item_type,omitempty"`
+	ItemID          string           `json:"item_id,omitempty"`
+	DeepLink        string           `json:"deeplink,omitempty"`
+	ImageURL        string           `json:"image_url,omitempty"`
+	Sound           string           `json:"sound,omitempty"`
+	ActorNickname   string           `json:"actor_nickname,omitempty"`
+	BadgeCount      *int             `json:"badge_count,omitempty"`
+	Actions         []Action         `json:"actions,omitempty"`
+	TrackingPayload *TrackingPayload `json:"tracking_payload,omitempty"`
+}
+
+// ToMap the FCM data payload of the app data, empty fields are left out.
+// Actions and the tracking payload are JSON encoded, with a stable key order.
+func (this *AppData) ToMap() map[string]string {
+	data := make(map[string]string)
+	setIfNotEmpty := func(key string, value string) {
+		if value != "" {
+			data[key] = value
+		}
+	}
+
+	setIfNotEmpty("title", this.Title)
+	setIfNotEmpty("body", this.Body)
+	setIfNotEmpty("item_type", string(this.ItemType))
+	setIfNotEmpty("item_id", this.ItemID)
+	setIfNotEmpty("deeplink", this.DeepLink)
+	setIfNotEmpty("image_url", this.ImageURL)
+	setIfNotEmpty("sound", this.Sound)
+	setIfNotEmpty("actor_nickname", this.ActorNickname)
+
+	if this.BadgeCount != nil {
+		data["badge_count"] = strconv.Itoa(*this.BadgeCount)
+	}
+
+	// marshalling slices of structs and structs of strings can't fail
+	if len(this.Actions) > 0 {
+		actions, _ := json.Marshal(this.Actions)
+		data["actions"] = string(actions)
+	}
+	if this.TrackingPayload != nil {
+		trackingPayload, _ := json.Marshal(this.TrackingPayload)
+		data["tracking_payload"] = string(trackingPayload)
+	}
+
+	return data
+}
+
+// DecodeAppData reads app data from an FCM data payload, the inverse of ToMap
+func DecodeAppData(data map[string]string) (*AppData, error) {
+	result := &AppData{
+		Title:         data["title"],
+		Body:          data["body"],
+		ItemType:      ItemType(data["item_type"]),
+		ItemID:        data["item_id"],
+		DeepLink:      data["deeplink"],
+		ImageURL:      data["image_url"],
+		Sound:         data["sound"],
+		ActorNickname: data["actor_nickname"],
+	}
+
+	if value, ok := data["badge_count"]; ok {
+		badgeCount, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("fcm: decoding badge_count: %w", err)
+		}
+		result.BadgeCount = &badgeCount
+	}
+
+	if value, ok := data["actions"]; ok {
+		if err := json.Unmarshal([]byte(value), &result.Actions); err != nil {
+			return nil, fmt.Errorf("fcm: decoding actions: %w", err)
+		}
+	}
+
+	if value, ok := data["tracking_payload"]; ok {
+		result.TrackingPayload = &TrackingPayload{}
+		if err := json.Unmarshal([]byte(value), result.TrackingPayload); err != nil {
+			return nil, fmt.Errorf("fcm: decoding tracking_payload: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+// SetAppData sets the data payload from typed app data
+func (this *FcmClient) SetAppData(data *AppData) *FcmClient {
+	this.Message.Data = data
+
+	return this
+}
+
+// badgeCountString formats the badge count of an untyped data payload,
+// which may be any integer or float (as decoded from JSON) or a numeric string
+func badgeCountString(value interface{}) (string, bool) {
+	switch badgeCount := value.(type) {
+	case int:
+		return strconv.Itoa(badgeCount), true
+	case int32:
+		return strconv.Itoa(int(badgeCount)), true
+	case int64:
+		return strconv.FormatInt(badgeCount, 10), true
+	case float64:
+		return strconv.Itoa(int(badgeCount)), true
+	case json.Number:
+		number, err := badgeCount.Int64()
+		return strconv.FormatInt(number, 10), err == nil
+	case string:
+		number, err := strconv.Atoi(badgeCount)
+		return strconv.Itoa(number), err == nil
+	}
+
+	return "", false
+}
@@ -0,0 +1,96 @@
+package fcm
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testAppData() *AppData {
+	badgeCount := 3
+
+	return &AppData{
+		Title:         "New like",
+		Body:          "Anna liked your catch",
+		ItemType:      ItemType_CATCH,
+		ItemID:        "42",
+		DeepLink:      "fishbrain://catches/42",
+		ActorNickname: "Anna",
+		BadgeCount:    &badgeCount,
+		Actions:       []Action{{Type: "Like", Value: "like"}},
+		TrackingPayload: &TrackingPayload{
+			Campaign:   "likes",
+			Properties: map[string]string{"variant": "b", "cohort": "2"},
+		},
+	}
+}
+
+func TestAppData_ToMap(t *testing.T) {
+	data := testAppData().ToMap()
+
+	require.Equal(t, map[string]string{
+		"title":            "New like",
+		"body":             "Anna liked your catch",
+		"item_type":        "Catch",
+		"item_id":          "42",
+		"deeplink":         "fishbrain://catches/42",
+		"actor_nickname":   "Anna",
+		"badge_count":      "3",
+		"actions":          `[{"type":"Like","value":"like"}]`,
+		"tracking_payload": `{"campaign":"likes","properties":{"cohort":"2","variant":"b"}}`,
+	}, data)
+
+	// the encoding is stable
+	require.Equal(t, data, testAppData().ToMap())
+}
+
+func TestDecodeAppData(t *testing.T) {
+	decoded, err := DecodeAppData(testAppData().ToMap())
+	require.Nil(t, err)
+	require.Equal(t, testAppData(), decoded)
+
+	_, err = DecodeAppData(map[string]string{"badge_count": "many"})
+	require.NotNil(t, err)
+
+	_, err = DecodeAppData(map[string]string{"actions": "like"})
+	require.NotNil(t, err)
+
+	// actions encoded before the json tags still decode
+	decoded, err = DecodeAppData(map[string]string{"actions": `[{"Type":"Like","Value":"like"}]`})
+	require.Nil(t, err)
+	require.Equal(t, []Action{{Type: "Like", Value: "like"}}, decoded.Actions)
+}
+
+func TestMakeMulticastMessageData_AppData(t *testing.T) {
+	msg := FcmMsg{Data: testAppData()}
+
+	res, ok := msg.makeMulticastMessageData()
+	require.True(t, ok)
+	require.Equal(t, testAppData().ToMap(), *res)
+
+	// app data stored as JSON, e.g. in a file outbox, is sent unchanged
+	encoded, err := json.Marshal(msg)
+	require.Nil(t, err)
+	var stored FcmMsg
+	require.Nil(t, json.Unmarshal(encoded, &stored))
+
+	res, ok = stored.makeMulticastMessageData()
+	require.True(t, ok)
+	require.Equal(t, testAppData().ToMap(), *res)
+}
+
+func TestMakeMulticastMessageData_BadgeCountTypes(t *testing.T) {
+	for _, badgeCount := range []interface{}{3, int64(3), 3.0, "3", json.Number("3")} {
+		msg := FcmMsg{Data: map[string]interface{}{"badge_count": badgeCount}}
+
+		res, ok := msg.makeMulticastMessageData()
+		require.True(t, ok)
+		require.Equal(t, "3", (*res)["badge_count"])
+	}
+
+	msg := FcmMsg{RegistrationIds: []string{"token0"}, Data: map[string]interface{}{"badge_count": "many"}}
+	_, ok := msg.makeMulticastMessageData()
+	require.False(t, ok)
+	require.Equal(t, []string{"data.badge_count"}, validationFields(t, msg.Validate()))
+}
@@ -0,0 +1,174 @@
+package fcm
+
+import (
+	"sync"
+
+	messaging "firebase.google.com/go/v4/messaging"
+)
+
+// BadgeCounter the unread count of every token, shown as the app badge.
+// Counts never go below zero.
+type BadgeCounter interface {
+	// Increment adds delta, which may be negative, to the token count
+	// and returns the new count
+	Increment(token string, delta int) (int, error)
+	// Reset sets the token count to zero
+	Reset(token string) error
+}
+
+// MemoryBadgeCounter an in-memory BadgeCounter, safe for concurrent use
+type MemoryBadgeCounter struct {
+	lock   sync.Mutex
+	counts map[string]int
+}
+
+// NewMemoryBadgeCounter creates an empty counter
+func NewMemoryBadgeCounter() *MemoryBadgeCounter {
+	return &MemoryBadgeCounter{counts: make(map[string]int)}
+}
+
+// Count the current count of the token
+func (this *MemoryBadgeCounter) Count(token string) (int, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	return this.counts[token], nil
+}
+
+// Increment adds delta to the token count, returning the new count
+func (this *MemoryBadgeCounter) Increment(token string, delta int) (int, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	count := this.counts[token] + delta
+	if count <= 0 {
+		delete(this.counts, token)
+		return 0, nil
+	}
+	this.counts[token] = count
+
+	return count, nil
+}
+
+// Reset sets the token count to zero
+func (this *MemoryBadgeCounter) Reset(token string) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	delete(this.counts, token)
+
+	return nil
+}
+
+// SetBadgeCounter enables the badge mode: every notification sent
+// increments the count of its tokens and sets it as the APNs badge and
+// the Android notification count, replacing the notification Badge.
+// Counts of failed sends are rolled back.
+func (this *FcmClient) SetBadgeCounter(counter BadgeCounter) *FcmClient {
+	this.Badges = counter
+
+	return this
+}
+
+// ResetBadge sets the badge count of the token to zero, e.g. when the
+// user has read everything
+func (this *FcmClient) ResetBadge(token string) error {
+	if this.Badges == nil {
+		return nil
+	}
+
+	return this.Badges.Reset(token)
+}
+
+// DecrementBadge subtracts delta from the badge count of the token,
+// e.g. when the user has read delta items, and returns the new count
+func (this *FcmClient) DecrementBadge(token string, delta int) (int, error) {
+	if this.Badges == nil {
+		return 0, nil
+	}
+
+	return this.Badges.Increment(token, -delta)
+}
+
+// badgeGroups increments the count of every token and splits the groups
+// (nil for a single group) by count. Returns groups unchanged when the
+// client isn't in badge mode.
+func (this *FcmClient) badgeGroups(groups []*multicastGroup, tokens []string) ([]*multicastGroup, error) {
+	if this.Badges == nil || this.Message.Notification == nil {
+		return groups, nil
+	}
+
+	if groups == nil {
+		group := &multicastGroup{notification: this.Message.Notification, tokens: tokens}
+		for i := range tokens {
+			group.indexes = append(group.indexes, i)
+		}
+		groups = []*multicastGroup{group}
+	}
+
+	var result []*multicastGroup
+	for groupIndex, group := range groups {
+		byCount := make(map[int]*multicastGroup)
+		for i, token := range group.tokens {
+			count, err := this.Badges.Increment(token, 1)
+			if err != nil {
+				this.rollbackGroupBadges(groups[:groupIndex], group.tokens[:i])
+				return nil, err
+			}
+
+			countGroup, ok := byCount[count]
+			if !ok {
+				badge := count
+				countGroup = &multicastGroup{notification: group.notification, badge: &badge}
+				byCount[count] = countGroup
+				result = append(result, countGroup)
+			}
+			countGroup.indexes = append(countGroup.indexes, group.indexes[i])
+			countGroup.tokens = append(countGroup.tokens, token)
+		}
+	}
+
+	return result, nil
+}
+
+// rollbackGroupBadges undoes the increments of the tokens of the groups
+// and of the extra tokens
+func (this *FcmClient) rollbackGroupBadges(groups []*multicastGroup, tokens []string) {
+	all := append([]string(nil), tokens...)
+	for _, group := range groups {
+		all = append(all, group.tokens...)
+	}
+
+	for _, token := range all {
+		if _, err := this.Badges.Increment(token, -1); err != nil {
+			this.logger().Error("error rolling back badge count", "error", err)
+		}
+	}
+}
+
+// rollbackBadges undoes the increments of the tokens not sent to
+func (this *FcmClient) rollbackBadges(tokens []string, resp *messaging.BatchResponse) {
+	if this.Badges == nil || this.Message.Notification == nil {
+		return
+	}
+
+	var failed []string
+	for i, response := range resp.Responses {
+		if i < len(tokens) && !response.Success {
+			failed = append(failed, tokens[i])
+		}
+	}
+
+	this.rollbackGroupBadges(nil, failed)
+}
+
+// setBadge sets the APNs badge and the Android notification count
+func setBadge(message *messaging.MulticastMessage, count int) {
+	if message.APNS != nil && message.APNS.Payload != nil && message.APNS.Payload.Aps != nil {
+		message.APNS.Payload.Aps.Badge = &count
+	}
+
+	if message.Notification != nil {
+		ensureAndroidNotification(message).NotificationCount = &count
+	}
+}
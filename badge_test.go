@@ -0,0 +1,103 @@
+package fcm
+
+import (
+	"errors"
+	"testing"
+
+	messaging "firebase.google.com/go/v4/messaging"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryBadgeCounter(t *testing.T) {
+	counter := NewMemoryBadgeCounter()
+
+	count, err := counter.Increment("token0", 2)
+	require.Nil(t, err)
+	require.Equal(t, 2, count)
+
+	// counts never go below zero
+	count, err = counter.Increment("token0", -5)
+	require.Nil(t, err)
+	require.Equal(t, 0, count)
+
+	_, _ = counter.Increment("token0", 3)
+	require.Nil(t, counter.Reset("token0"))
+	count, err = counter.Count("token0")
+	require.Nil(t, err)
+	require.Equal(t, 0, count)
+}
+
+func badgeOf(message *messaging.MulticastMessage) int {
+	return *message.APNS.Payload.Aps.Badge
+}
+
+func TestSend_BadgeMode(t *testing.T) {
+	counter := NewMemoryBadgeCounter()
+	_, _ = counter.Increment("token1", 4)
+	_, _ = counter.Increment("token2", 4)
+
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.MatchedBy(func(message *messaging.MulticastMessage) bool {
+		return badgeOf(message) == 1 && *message.Android.Notification.NotificationCount == 1 &&
+			len(message.Tokens) == 2 && message.Tokens[0] == "token0" && message.Tokens[1] == "token3"
+	})).Return(&messaging.BatchResponse{
+		SuccessCount: 1,
+		FailureCount: 1,
+		Responses: []*messaging.SendResponse{
+			{Success: true, MessageID: "0"},
+			{Error: errors.New("unregistered")},
+		},
+	}, nil).Once()
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.MatchedBy(func(message *messaging.MulticastMessage) bool {
+		return badgeOf(message) == 5 && len(message.Tokens) == 2
+	})).Return(&messaging.BatchResponse{
+		SuccessCount: 2,
+		Responses:    []*messaging.SendResponse{{Success: true, MessageID: "1"}, {Success: true, MessageID: "2"}},
+	}, nil).Once()
+
+	c := NewFcmClient("key").
+		SetMessagingClient(messagingClientMock).
+		SetBadgeCounter(counter).
+		NewFcmRegIdsMsg([]string{"token0", "token1", "token2", "token3"}, nil).
+		SetNotificationPayload(&NotificationPayload{Title: "title", Badge: "99"})
+
+	status, err := c.Send()
+	require.Nil(t, err)
+	messagingClientMock.AssertExpectations(t)
+	require.Equal(t, 3, status.Success)
+	require.Equal(t, "1", status.Results[1]["messageID"])
+
+	for token, expected := range map[string]int{"token0": 1, "token1": 5, "token2": 5, "token3": 0} {
+		count, err := counter.Count(token)
+		require.Nil(t, err)
+		require.Equal(t, expected, count, token)
+	}
+
+	count, err := c.DecrementBadge("token1", 2)
+	require.Nil(t, err)
+	require.Equal(t, 3, count)
+	require.Nil(t, c.ResetBadge("token1"))
+	count, _ = counter.Count("token1")
+	require.Equal(t, 0, count)
+}
+
+func TestSend_BadgeModeRollsBackFailedSend(t *testing.T) {
+	counter := NewMemoryBadgeCounter()
+
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.Anything).
+		Return((*messaging.BatchResponse)(nil), errors.New("unavailable"))
+
+	c := NewFcmClient("key").
+		SetMessagingClient(messagingClientMock).
+		SetBadgeCounter(counter).
+		NewFcmRegIdsMsg([]string{"token0"}, nil).
+		SetNotificationPayload(&NotificationPayload{Title: "title"})
+
+	_, err := c.Send()
+	require.NotNil(t, err)
+
+	count, _ := counter.Count("token0")
+	require.Equal(t, 0, count)
+}
@@ -0,0 +1,325 @@
+package fcm
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// MAX_CONDITION_TOPICS the maximum number of topics in a condition
+	MAX_CONDITION_TOPICS = 5
+)
+
+const (
+	// condition operators
+	condition_topic = iota
+	condition_and
+	condition_or
+	condition_not
+)
+
+// ConditionExpr a topic condition expression, e.g.
+// InTopic("a").And(InTopic("b").Not()) renders as 'a' in topics && !('b' in topics)
+type ConditionExpr struct {
+	op       int
+	topic    string
+	operands []*ConditionExpr
+}
+
+// topicQuoteEscaper escapes the quotes of an invalid topic name, so it
+// can't end its quoted string and change the condition
+var topicQuoteEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// InTopic matches devices subscribed to topic. An invalid topic name is
+// rejected by Validate, and by FCM: its quotes are escaped when rendered,
+// so it can't change the meaning of the condition
+func InTopic(topic string) *ConditionExpr {
+	return &ConditionExpr{op: condition_topic, topic: extractTopicName(topic)}
+}
+
+// And matches devices matching this and every other expression
+func (this *ConditionExpr) And(others ...*ConditionExpr) *ConditionExpr {
+	return combineConditions(condition_and, this, others)
+}
+
+// Or matches devices matching this or any other expression
+func (this *ConditionExpr) Or(others ...*ConditionExpr) *ConditionExpr {
+	return combineConditions(condition_or, this, others)
+}
+
+// Not matches devices not matching this expression
+func (this *ConditionExpr) Not() *ConditionExpr {
+	return &ConditionExpr{op: condition_not, operands: []*ConditionExpr{this}}
+}
+
+// combineConditions joins expressions with op, flattening nested ones with the same op
+func combineConditions(op int, first *ConditionExpr, others []*ConditionExpr) *ConditionExpr {
+	result := &ConditionExpr{op: op}
+	for _, expr := range append([]*ConditionExpr{first}, others...) {
+		if expr.op == op {
+			result.operands = append(result.operands, expr.operands...)
+		} else {
+			result.operands = append(result.operands, expr)
+		}
+	}
+
+	return result
+}
+
+// String renders the expression in FCM condition syntax
+func (this *ConditionExpr) String() string {
+	switch this.op {
+	case condition_topic:
+		return "'" + topicQuoteEscaper.Replace(this.topic) + "' in topics"
+	case condition_not:
+		return "!(" + this.operands[0].String() + ")"
+	}
+
+	separator := " && "
+	if this.op == condition_or {
+		separator = " || "
+	}
+
+	parts := make([]string, 0, len(this.operands))
+	for _, operand := range this.operands {
+		// && binds tighter than ||, so only an || inside an && needs parentheses
+		if this.op == condition_and && operand.op == condition_or {
+			parts = append(parts, "("+operand.String()+")")
+		} else {
+			parts = append(parts, operand.String())
+		}
+	}
+
+	return strings.Join(parts, separator)
+}
+
+// Topics the distinct topics used by the expression, in order of appearance
+func (this *ConditionExpr) Topics() []string {
+	var result []string
+	seen := make(map[string]bool)
+
+	var walk func(expr *ConditionExpr)
+	walk = func(expr *ConditionExpr) {
+		if expr.op == condition_topic {
+			if !seen[expr.topic] {
+				seen[expr.topic] = true
+				result = append(result, expr.topic)
+			}
+			return
+		}
+		for _, operand := range expr.operands {
+			walk(operand)
+		}
+	}
+	walk(this)
+
+	return result
+}
+
+// TopicCount number of distinct topics used by the expression
+func (this *ConditionExpr) TopicCount() int {
+	return len(this.Topics())
+}
+
+// WithinLimits whether the expression uses at most MAX_CONDITION_TOPICS topics
+func (this *ConditionExpr) WithinLimits() bool {
+	return this.TopicCount() <= MAX_CONDITION_TOPICS
+}
+
+// Validate checks the topic names and the number of topics
+func (this *ConditionExpr) Validate() error {
+	v := new(validator)
+
+	for _, topic := range this.Topics() {
+		if _, err := ParseTopic(topic); err != nil {
+			v.addErr("condition", err)
+		}
+	}
+
+	if count := this.TopicCount(); count > MAX_CONDITION_TOPICS {
+		v.add("condition", "uses %d topics, at most %d are allowed", count, MAX_CONDITION_TOPICS)
+	}
+
+	return v.err()
+}
+
+// SetConditionExpr sets the message condition from an expression
+func (this *FcmClient) SetConditionExpr(expr *ConditionExpr) *FcmClient {
+	this.Message.Condition = expr.String()
+
+	return this
+}
+
+// ConditionSyntaxError returned by ParseCondition for malformed conditions
+type ConditionSyntaxError struct {
+	Condition string
+	// Pos byte offset of the error in Condition
+	Pos     int
+	Message string
+}
+
+// Error describes the syntax error and its position
+func (this *ConditionSyntaxError) Error() string {
+	return fmt.Sprintf("fcm: invalid condition at %d: %s", this.Pos, this.Message)
+}
+
+// conditionParser a recursive descent parser of FCM conditions:
+//
+//	or    := and ('||' and)*
+//	and   := unary ('&&' unary)*
+//	unary := '!' unary | '(' or ')' | topic 'in' 'topics'
+type conditionParser struct {
+	input string
+	pos   int
+}
+
+// ParseCondition parses a condition string, e.g.
+// "'a' in topics && ('b' in topics || 'c' in topics)", into an expression
+func ParseCondition(condition string) (*ConditionExpr, error) {
+	p := &conditionParser{input: condition}
+
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return nil, p.errorf("unexpected %q", p.input[p.pos:])
+	}
+
+	return expr, nil
+}
+
+// errorf builds a syntax error at the current position
+func (this *conditionParser) errorf(format string, args ...interface{}) error {
+	return &ConditionSyntaxError{
+		Condition: this.input,
+		Pos:       this.pos,
+		Message:   fmt.Sprintf(format, args...),
+	}
+}
+
+// skipSpaces moves past whitespace
+func (this *conditionParser) skipSpaces() {
+	for this.pos < len(this.input) && strings.ContainsRune(" \t\r\n", rune(this.input[this.pos])) {
+		this.pos++
+	}
+}
+
+// consume moves past token when it comes next
+func (this *conditionParser) consume(token string) bool {
+	this.skipSpaces()
+	if strings.HasPrefix(this.input[this.pos:], token) {
+		this.pos += len(token)
+		return true
+	}
+
+	return false
+}
+
+// parseOr parses expressions joined with ||
+func (this *conditionParser) parseOr() (*ConditionExpr, error) {
+	expr, err := this.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for this.consume("||") {
+		next, err := this.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		expr = expr.Or(next)
+	}
+
+	return expr, nil
+}
+
+// parseAnd parses expressions joined with &&
+func (this *conditionParser) parseAnd() (*ConditionExpr, error) {
+	expr, err := this.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for this.consume("&&") {
+		next, err := this.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		expr = expr.And(next)
+	}
+
+	return expr, nil
+}
+
+// parseUnary parses a negation, a parenthesised expression or a topic
+func (this *conditionParser) parseUnary() (*ConditionExpr, error) {
+	if this.consume("!") {
+		expr, err := this.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return expr.Not(), nil
+	}
+
+	if this.consume("(") {
+		expr, err := this.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !this.consume(")") {
+			return nil, this.errorf("expected ')'")
+		}
+		return expr, nil
+	}
+
+	return this.parseTopic()
+}
+
+// parseTopic parses 'topic' in topics, with single or double quotes
+func (this *conditionParser) parseTopic() (*ConditionExpr, error) {
+	this.skipSpaces()
+	if this.pos >= len(this.input) {
+		return nil, this.errorf("unexpected end of condition, expected a topic")
+	}
+
+	quote := this.input[this.pos]
+	if quote != '\'' && quote != '"' {
+		return nil, this.errorf("expected a quoted topic name")
+	}
+
+	end := strings.IndexByte(this.input[this.pos+1:], quote)
+	if end < 0 {
+		return nil, this.errorf("unterminated topic name")
+	}
+	topic := this.input[this.pos+1 : this.pos+1+end]
+	this.pos += end + 2
+
+	if !this.consumeWord("in") || !this.consumeWord("topics") {
+		return nil, this.errorf("expected 'in topics' after topic %q", topic)
+	}
+
+	return &ConditionExpr{op: condition_topic, topic: topic}, nil
+}
+
+// consumeWord moves past word when it comes next as a whole word
+func (this *conditionParser) consumeWord(word string) bool {
+	this.skipSpaces()
+	rest := this.input[this.pos:]
+	if !strings.HasPrefix(rest, word) {
+		return false
+	}
+	if len(rest) > len(word) && isConditionWordChar(rest[len(word)]) {
+		return false
+	}
+	this.pos += len(word)
+
+	return true
+}
+
+// isConditionWordChar whether c may be part of a keyword
+func isConditionWordChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
@@ -0,0 +1,89 @@
+package fcm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditionExpr_String(t *testing.T) {
+	expr := InTopic("a").And(InTopic("b").Not())
+	require.Equal(t, "'a' in topics && !('b' in topics)", expr.String())
+
+	expr = InTopic("/topics/a").And(InTopic("b").Or(InTopic("c")))
+	require.Equal(t, "'a' in topics && ('b' in topics || 'c' in topics)", expr.String())
+
+	expr = InTopic("a").And(InTopic("b")).Or(InTopic("c"), InTopic("d"))
+	require.Equal(t, "'a' in topics && 'b' in topics || 'c' in topics || 'd' in topics", expr.String())
+
+	c := NewFcmClient("key").SetConditionExpr(InTopic("a").Or(InTopic("b")))
+	require.Equal(t, "'a' in topics || 'b' in topics", c.Message.Condition)
+}
+
+func TestParseCondition_RoundTrip(t *testing.T) {
+	for _, condition := range []string{
+		"'a' in topics",
+		"'a' in topics && !('b' in topics)",
+		"'a' in topics && ('b' in topics || 'c' in topics)",
+		"'a' in topics && 'b' in topics || 'c' in topics",
+		"!('a' in topics && 'b' in topics)",
+	} {
+		expr, err := ParseCondition(condition)
+		require.Nil(t, err, condition)
+		require.Equal(t, condition, expr.String())
+	}
+
+	expr, err := ParseCondition(`("lake-vanern" in topics||'pike' in topics) && !  'news' in topics`)
+	require.Nil(t, err)
+	require.Equal(t, "('lake-vanern' in topics || 'pike' in topics) && !('news' in topics)", expr.String())
+	require.Equal(t, []string{"lake-vanern", "pike", "news"}, expr.Topics())
+}
+
+func TestParseCondition_SyntaxErrors(t *testing.T) {
+	for _, condition := range []string{
+		"",
+		"'a' in topic",
+		"'a' in topics &&",
+		"('a' in topics",
+		"'a in topics",
+		"a in topics",
+		"'a' in topics 'b' in topics",
+	} {
+		_, err := ParseCondition(condition)
+		var syntaxErr *ConditionSyntaxError
+		require.True(t, errors.As(err, &syntaxErr), condition)
+	}
+}
+
+func TestConditionExpr_Limits(t *testing.T) {
+	expr, err := ParseCondition("'a' in topics || 'b' in topics || 'c' in topics || 'd' in topics || 'e' in topics")
+	require.Nil(t, err)
+	require.Equal(t, 5, expr.TopicCount())
+	require.True(t, expr.WithinLimits())
+	require.Nil(t, expr.Validate())
+
+	// repeated topics count once
+	expr = expr.And(InTopic("a").Not())
+	require.Equal(t, 5, expr.TopicCount())
+
+	expr = expr.Or(InTopic("f"))
+	require.Equal(t, 6, expr.TopicCount())
+	require.False(t, expr.WithinLimits())
+	require.NotNil(t, expr.Validate())
+
+	require.NotNil(t, InTopic("bad topic").Validate())
+}
+
+func TestConditionExpr_InvalidTopicCantChangeCondition(t *testing.T) {
+	expr := InTopic("a' in topics || 'b")
+	require.Equal(t, `'a\' in topics || \'b' in topics`, expr.String())
+
+	var topicErr *InvalidTopicError
+	require.True(t, errors.As(expr.Validate(), &topicErr))
+
+	c := NewFcmClient("key").SetConditionExpr(InTopic("news").And(expr))
+	_, err := ParseCondition(c.Message.Condition)
+	require.NotNil(t, err)
+	require.Equal(t, []string{"condition"}, validationFields(t, c.Validate()))
+}
@@ -0,0 +1,226 @@
+package fcm
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// clock_time_layout layout of the delivery window bounds
+	clock_time_layout = "15:04"
+)
+
+// DeliveryWindow the time of day, in the recipient local time, a message
+// may be delivered at, e.g. 08:00-21:00. Windows may wrap midnight (22:00-06:00).
+type DeliveryWindow struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// DefaultTimeZone IANA time zone used for tokens without a known one,
+	// when empty these tokens are not held
+	DefaultTimeZone string `json:"default_time_zone,omitempty"`
+}
+
+// NewDeliveryWindow creates a window between start and end, both "HH:MM"
+func NewDeliveryWindow(start string, end string) (*DeliveryWindow, error) {
+	window := &DeliveryWindow{Start: start, End: end}
+	if err := window.Validate(); err != nil {
+		return nil, err
+	}
+
+	return window, nil
+}
+
+// Validate checks the window bounds and default time zone
+func (this *DeliveryWindow) Validate() error {
+	if _, err := parseClockTime(this.Start); err != nil {
+		return fmt.Errorf("fcm: invalid delivery window start %q: %w", this.Start, err)
+	}
+	if _, err := parseClockTime(this.End); err != nil {
+		return fmt.Errorf("fcm: invalid delivery window end %q: %w", this.End, err)
+	}
+	if this.DefaultTimeZone != "" {
+		if _, err := time.LoadLocation(this.DefaultTimeZone); err != nil {
+			return fmt.Errorf("fcm: invalid delivery window time zone %q: %w", this.DefaultTimeZone, err)
+		}
+	}
+
+	return nil
+}
+
+// NextOpen returns now when the window is open at now in loc,
+// otherwise the time the window opens next
+func (this *DeliveryWindow) NextOpen(now time.Time, loc *time.Location) (time.Time, error) {
+	start, err := parseClockTime(this.Start)
+	if err != nil {
+		return now, err
+	}
+	end, err := parseClockTime(this.End)
+	if err != nil {
+		return now, err
+	}
+
+	// wall clock minutes, not the time elapsed since midnight, which
+	// differs on the days daylight saving time starts or ends
+	local := now.In(loc)
+	clock := local.Hour()*60 + local.Minute()
+
+	var open bool
+	switch {
+	case start == end:
+		open = true
+	case start < end:
+		open = clock >= start && clock < end
+	default:
+		open = clock >= start || clock < end
+	}
+	if open {
+		return now, nil
+	}
+
+	opens := time.Date(local.Year(), local.Month(), local.Day(), start/60, start%60, 0, 0, loc)
+	if !opens.After(local) {
+		opens = time.Date(local.Year(), local.Month(), local.Day()+1, start/60, start%60, 0, 0, loc)
+	}
+
+	return opens, nil
+}
+
+// parseClockTime parses "HH:MM" into the minutes since midnight
+func parseClockTime(value string) (int, error) {
+	t, err := time.Parse(clock_time_layout, value)
+	if err != nil {
+		return 0, err
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// SetDeliveryWindow holds the message for each token until the window
+// opens in the token time zone. Applied by the Dispatcher.
+func (this *FcmClient) SetDeliveryWindow(window *DeliveryWindow) *FcmClient {
+	this.Message.DeliveryWindow = window
+
+	return this
+}
+
+// SetTokenTimeZone sets the IANA time zone (e.g. "Europe/Stockholm") of a token
+func (this *FcmClient) SetTokenTimeZone(token string, timeZone string) *FcmClient {
+	if this.Message.TimeZones == nil {
+		this.Message.TimeZones = make(map[string]string)
+	}
+	this.Message.TimeZones[token] = timeZone
+
+	return this
+}
+
+// SetTokenTimeZones sets the IANA time zones of many tokens
+func (this *FcmClient) SetTokenTimeZones(timeZones map[string]string) *FcmClient {
+	for token, timeZone := range timeZones {
+		this.SetTokenTimeZone(token, timeZone)
+	}
+
+	return this
+}
+
+// SetUrgent urgent messages are delivered right away, ignoring the delivery window
+func (this *FcmClient) SetUrgent(urgent bool) *FcmClient {
+	this.Message.Urgent = urgent
+
+	return this
+}
+
+// windowedMsg part of a message to be delivered not before a given time
+type windowedMsg struct {
+	Message   FcmMsg
+	NotBefore time.Time
+	Tokens    int
+	Deferred  bool
+}
+
+// splitByDeliveryWindow groups the message tokens by the time their
+// delivery window opens. Messages without a window, urgent ones and
+// messages not targeting tokens are returned as they are.
+func (this *FcmMsg) splitByDeliveryWindow(now time.Time) ([]*windowedMsg, error) {
+	window := this.DeliveryWindow
+	if window == nil || this.Urgent {
+		return []*windowedMsg{{Message: *this, Tokens: len(this.RegistrationIds)}}, nil
+	}
+
+	if err := window.Validate(); err != nil {
+		return nil, err
+	}
+
+	locations := make(map[string]*time.Location)
+	location := func(timeZone string) (*time.Location, error) {
+		if loc, ok := locations[timeZone]; ok {
+			return loc, nil
+		}
+		loc, err := time.LoadLocation(timeZone)
+		if err != nil {
+			return nil, fmt.Errorf("fcm: invalid time zone %q: %w", timeZone, err)
+		}
+		locations[timeZone] = loc
+		return loc, nil
+	}
+
+	if len(this.RegistrationIds) == 0 {
+		if window.DefaultTimeZone == "" {
+			return []*windowedMsg{{Message: *this}}, nil
+		}
+		loc, err := location(window.DefaultTimeZone)
+		if err != nil {
+			return nil, err
+		}
+		opens, err := window.NextOpen(now, loc)
+		if err != nil {
+			return nil, err
+		}
+		return []*windowedMsg{{Message: *this, NotBefore: opens, Deferred: opens.After(now)}}, nil
+	}
+
+	groups := make(map[int64]*windowedMsg)
+	for _, token := range this.RegistrationIds {
+		timeZone := this.TimeZones[token]
+		if timeZone == "" {
+			timeZone = window.DefaultTimeZone
+		}
+
+		opens := now
+		if timeZone != "" {
+			loc, err := location(timeZone)
+			if err != nil {
+				return nil, err
+			}
+			if opens, err = window.NextOpen(now, loc); err != nil {
+				return nil, err
+			}
+		}
+
+		key := opens.Unix()
+		group, ok := groups[key]
+		if !ok {
+			group = &windowedMsg{
+				Message:   *this,
+				NotBefore: opens,
+				Deferred:  opens.After(now),
+			}
+			group.Message.RegistrationIds = nil
+			group.Message.TimeZones = nil
+			group.Message.DeliveryWindow = nil
+			groups[key] = group
+		}
+		group.Message.RegistrationIds = append(group.Message.RegistrationIds, token)
+		group.Tokens++
+	}
+
+	result := make([]*windowedMsg, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, group)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].NotBefore.Before(result[j].NotBefore)
+	})
+
+	return result, nil
+}
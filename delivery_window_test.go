@@ -0,0 +1,141 @@
+package fcm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeliveryWindow_NextOpen(t *testing.T) {
+	stockholm, err := time.LoadLocation("Europe/Stockholm")
+	require.Nil(t, err)
+
+	window, err := NewDeliveryWindow("08:00", "21:00")
+	require.Nil(t, err)
+
+	// 03:00 local, opens at 08:00 the same day
+	now := time.Date(2024, 5, 1, 3, 0, 0, 0, stockholm)
+	opens, err := window.NextOpen(now, stockholm)
+	require.Nil(t, err)
+	require.Equal(t, time.Date(2024, 5, 1, 8, 0, 0, 0, stockholm), opens)
+
+	// 12:00 local, open
+	now = time.Date(2024, 5, 1, 12, 0, 0, 0, stockholm)
+	opens, _ = window.NextOpen(now, stockholm)
+	require.Equal(t, now, opens)
+
+	// 22:30 local, opens at 08:00 the next day
+	now = time.Date(2024, 5, 1, 22, 30, 0, 0, stockholm)
+	opens, _ = window.NextOpen(now, stockholm)
+	require.Equal(t, time.Date(2024, 5, 2, 8, 0, 0, 0, stockholm), opens)
+
+	// windows wrapping midnight
+	night, err := NewDeliveryWindow("22:00", "06:00")
+	require.Nil(t, err)
+	opens, _ = night.NextOpen(now, stockholm)
+	require.Equal(t, now, opens)
+	now = time.Date(2024, 5, 1, 7, 0, 0, 0, stockholm)
+	opens, _ = night.NextOpen(now, stockholm)
+	require.Equal(t, time.Date(2024, 5, 1, 22, 0, 0, 0, stockholm), opens)
+
+	_, err = NewDeliveryWindow("8am", "21:00")
+	require.NotNil(t, err)
+}
+
+func TestDeliveryWindow_NextOpenDST(t *testing.T) {
+	stockholm, err := time.LoadLocation("Europe/Stockholm")
+	require.Nil(t, err)
+
+	window, err := NewDeliveryWindow("08:00", "21:00")
+	require.Nil(t, err)
+
+	// clocks go forward at 02:00 on 2024-03-31, the window still opens at 08:00
+	now := time.Date(2024, 3, 31, 1, 30, 0, 0, stockholm)
+	opens, err := window.NextOpen(now, stockholm)
+	require.Nil(t, err)
+	require.Equal(t, time.Date(2024, 3, 31, 8, 0, 0, 0, stockholm), opens)
+	require.Equal(t, 8, opens.In(stockholm).Hour())
+
+	now = time.Date(2024, 3, 31, 7, 30, 0, 0, stockholm)
+	opens, _ = window.NextOpen(now, stockholm)
+	require.Equal(t, time.Date(2024, 3, 31, 8, 0, 0, 0, stockholm), opens)
+
+	now = time.Date(2024, 3, 31, 20, 30, 0, 0, stockholm)
+	opens, _ = window.NextOpen(now, stockholm)
+	require.Equal(t, now, opens)
+
+	// clocks go back at 03:00 on 2024-10-27
+	now = time.Date(2024, 10, 27, 7, 30, 0, 0, stockholm)
+	opens, _ = window.NextOpen(now, stockholm)
+	require.Equal(t, time.Date(2024, 10, 27, 8, 0, 0, 0, stockholm), opens)
+	require.Equal(t, 8, opens.In(stockholm).Hour())
+
+	now = time.Date(2024, 10, 27, 21, 30, 0, 0, stockholm)
+	opens, _ = window.NextOpen(now, stockholm)
+	require.Equal(t, time.Date(2024, 10, 28, 8, 0, 0, 0, stockholm), opens)
+}
+
+func TestDispatcher_HoldsTokensUntilWindowOpens(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.Anything).Return(successBatchResponse(), nil)
+
+	// 02:00 UTC: 04:00 in Stockholm, 22:00 (the day before) in New York, 10:00 in Tokyo
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)}
+	outbox := NewMemoryOutbox()
+	c := NewFcmClient("key").SetMessagingClient(messagingClientMock)
+	d := NewDispatcher(c, outbox, DispatcherOptions{Clock: clock, PollInterval: time.Hour})
+
+	window, _ := NewDeliveryWindow("08:00", "21:00")
+	c.NewFcmRegIdsMsg([]string{"sweden", "usa", "japan", "unknown"}, nil).
+		SetDeliveryWindow(window).
+		SetTokenTimeZones(map[string]string{
+			"sweden": "Europe/Stockholm",
+			"usa":    "America/New_York",
+			"japan":  "Asia/Tokyo",
+		})
+
+	result, err := d.Enqueue(c.Message)
+	require.Nil(t, err)
+	require.Equal(t, 2, result.Immediate)
+	require.Equal(t, 2, result.Deferred)
+	require.Len(t, result.IDs, 3)
+
+	require.Nil(t, d.Close(context.Background()))
+	messagingClientMock.AssertNumberOfCalls(t, "SendEachForMulticast", 1)
+
+	// the held sends stay in the outbox until their window opens
+	entry, ok, _ := outbox.Take(time.Date(2024, 5, 1, 6, 0, 0, 0, time.UTC))
+	require.True(t, ok)
+	require.Equal(t, []string{"sweden"}, entry.Message.RegistrationIds)
+	_, ok, _ = outbox.Take(time.Date(2024, 5, 1, 11, 59, 0, 0, time.UTC))
+	require.False(t, ok)
+	entry, ok, _ = outbox.Take(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	require.True(t, ok)
+	require.Equal(t, []string{"usa"}, entry.Message.RegistrationIds)
+}
+
+func TestDispatcher_UrgentIgnoresWindow(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.Anything).Return(successBatchResponse(), nil)
+
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)}
+	c := NewFcmClient("key").SetMessagingClient(messagingClientMock)
+	d := NewDispatcher(c, NewMemoryOutbox(), DispatcherOptions{Clock: clock})
+
+	window, _ := NewDeliveryWindow("08:00", "21:00")
+	c.NewFcmRegIdsMsg([]string{"sweden"}, nil).
+		SetDeliveryWindow(window).
+		SetTokenTimeZone("sweden", "Europe/Stockholm").
+		SetUrgent(true)
+
+	result, err := d.Enqueue(c.Message)
+	require.Nil(t, err)
+	require.Equal(t, 1, result.Immediate)
+	require.Equal(t, 0, result.Deferred)
+
+	require.Nil(t, d.Close(context.Background()))
+	messagingClientMock.AssertNumberOfCalls(t, "SendEachForMulticast", 1)
+}
@@ -0,0 +1,338 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// default_dispatcher_workers number of concurrent senders
+	default_dispatcher_workers = 1
+	// default_dispatcher_max_attempts delivery attempts before giving up
+	default_dispatcher_max_attempts = 3
+	// default_dispatcher_retry_backoff wait before the first retry, doubled on every further attempt
+	default_dispatcher_retry_backoff = time.Second
+	// default_dispatcher_poll_interval how often idle workers look for due entries
+	default_dispatcher_poll_interval = time.Second
+)
+
+var (
+	// ErrDispatcherClosed returned when enqueuing to a closed Dispatcher
+	ErrDispatcherClosed = errors.New("fcm: dispatcher is closed")
+)
+
+// DispatcherOptions configures a Dispatcher, zero values use the defaults
+type DispatcherOptions struct {
+	// Workers number of messages delivered concurrently
+	Workers int
+	// MaxAttempts delivery attempts of a message before it is dropped
+	MaxAttempts int
+	// RetryBackoff wait before retrying a failed delivery,
+	// doubled on every further attempt
+	RetryBackoff time.Duration
+	// PollInterval how often idle workers check the outbox for due entries
+	PollInterval time.Duration
+	// Clock source of the current time, the wall clock by default
+	Clock Clock
+	// Retryable whether a token whose send failed with err is retried,
+	// by default on FCM UNAVAILABLE, INTERNAL and QUOTA_EXCEEDED errors.
+	// A failed send of the whole message is retried on these errors and on
+	// transport errors, never on validation errors
+	Retryable func(err error) bool
+	// OnResult when set is called with the final outcome of every entry,
+	// either delivered or dropped after the last failed attempt. When some
+	// tokens were retried, status is the one of the last attempt, sent to
+	// the retried tokens, and entry.Delivered counts the earlier deliveries
+	OnResult func(entry *OutboxEntry, status *FcmResponseStatus, err error)
+}
+
+// Dispatcher accepts messages onto an Outbox and delivers them in the
+// background through an FcmClient, so callers don't wait for FCM
+type Dispatcher struct {
+	client *FcmClient
+	outbox Outbox
+	opts   DispatcherOptions
+
+	mu     sync.RWMutex
+	closed bool
+	wake   chan struct{}
+	drain  chan struct{}
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewDispatcher creates a Dispatcher delivering the messages queued in
+// outbox with the configuration of client, and starts its workers.
+// Entries already in a durable outbox are delivered too.
+func NewDispatcher(client *FcmClient, outbox Outbox, opts DispatcherOptions) *Dispatcher {
+	if opts.Workers <= 0 {
+		opts.Workers = default_dispatcher_workers
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = default_dispatcher_max_attempts
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = default_dispatcher_retry_backoff
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = default_dispatcher_poll_interval
+	}
+	if opts.Clock == nil {
+		opts.Clock = systemClock{}
+	}
+	if opts.Retryable == nil {
+		opts.Retryable = retryableSendError
+	}
+
+	d := &Dispatcher{
+		client: client,
+		outbox: outbox,
+		opts:   opts,
+		wake:   make(chan struct{}, opts.Workers),
+		drain:  make(chan struct{}),
+		stop:   make(chan struct{}),
+	}
+
+	d.wg.Add(opts.Workers)
+	for i := 0; i < opts.Workers; i++ {
+		go d.work()
+	}
+
+	return d
+}
+
+// EnqueueResult the outcome of queueing a message
+type EnqueueResult struct {
+	// IDs the outbox entries created, a message held by its delivery
+	// window is split into one entry per window opening time
+	IDs []string
+	// Immediate number of sends queued for delivery right away
+	Immediate int
+	// Deferred number of sends held until their delivery window opens
+	Deferred int
+}
+
+// Enqueue queues a message for delivery. When the message has a
+// DeliveryWindow, the send to each token is held until the window
+// opens in the token time zone, unless the message is urgent.
+func (this *Dispatcher) Enqueue(msg FcmMsg) (*EnqueueResult, error) {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	if this.closed {
+		return nil, ErrDispatcherClosed
+	}
+
+	now := this.opts.Clock.Now()
+	parts, err := msg.splitByDeliveryWindow(now)
+	if err != nil {
+		return nil, err
+	}
+
+	result := new(EnqueueResult)
+	for _, part := range parts {
+		entry := &OutboxEntry{
+			ID:         newEntryID(),
+			Message:    part.Message,
+			EnqueuedAt: now,
+			NotBefore:  part.NotBefore,
+		}
+
+		if err := this.outbox.Put(entry); err != nil {
+			return result, err
+		}
+
+		sends := part.Tokens
+		if sends == 0 {
+			sends = 1
+		}
+
+		result.IDs = append(result.IDs, entry.ID)
+		if part.Deferred {
+			result.Deferred += sends
+		} else {
+			result.Immediate += sends
+		}
+	}
+
+	this.notify()
+
+	return result, nil
+}
+
+// notify wakes up an idle worker, if any
+func (this *Dispatcher) notify() {
+	select {
+	case this.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops accepting messages and waits until the entries due are
+// delivered. When ctx is done first the workers stop after their current
+// send, leaving the rest in the outbox, and ctx.Err() is returned.
+// Entries waiting for a retry stay in the outbox, the outbox itself is not closed.
+func (this *Dispatcher) Close(ctx context.Context) error {
+	this.mu.Lock()
+	if this.closed {
+		this.mu.Unlock()
+		return ErrDispatcherClosed
+	}
+	this.closed = true
+	close(this.drain)
+	this.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		this.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		close(this.stop)
+		<-done
+		return ctx.Err()
+	}
+}
+
+// work delivers due entries until the dispatcher is closed
+func (this *Dispatcher) work() {
+	defer this.wg.Done()
+
+	for {
+		select {
+		case <-this.stop:
+			return
+		default:
+		}
+
+		entry, ok, err := this.outbox.Take(this.opts.Clock.Now())
+		if err == nil && ok {
+			this.deliver(entry)
+			continue
+		}
+
+		select {
+		case <-this.drain:
+			return
+		default:
+		}
+
+		select {
+		case <-this.wake:
+		case <-this.drain:
+		case <-this.stop:
+			return
+		case <-time.After(this.opts.PollInterval):
+		}
+	}
+}
+
+// deliver sends an entry, putting it back into the outbox for a later
+// retry when the send fails, or with only the tokens to retry when some
+// of its sends failed with a retryable error
+func (this *Dispatcher) deliver(entry *OutboxEntry) {
+	entry.Attempts++
+	if entry.Attempts > 1 {
+		this.client.metrics().Retried(entry.Attempts)
+	}
+
+	tokenErrors := make(map[string]error)
+	ctx, span := this.client.startSpan(context.Background(), span_deliver, attr_attempt.Int(entry.Attempts))
+	status, err := this.client.withMessage(entry.Message).send(withTokenErrors(ctx, tokenErrors))
+	endSpan(span, err)
+
+	if entry.Attempts < this.opts.MaxAttempts {
+		var retry *OutboxEntry
+		switch {
+		case err == nil:
+			retry = this.retryTokens(entry, status, tokenErrors)
+		case this.retryableDelivery(err):
+			retry = entry
+		}
+		if retry != nil {
+			retry.NotBefore = this.opts.Clock.Now().Add(this.backoff(entry.Attempts))
+			putErr := this.outbox.Put(retry)
+			if putErr == nil {
+				return
+			}
+			err = errors.Join(err, fmt.Errorf("fcm: error requeueing outbox entry: %w", putErr))
+		}
+	}
+
+	if ackErr := this.outbox.Ack(entry.ID); ackErr != nil && err == nil {
+		err = ackErr
+	}
+
+	if this.opts.OnResult != nil {
+		this.opts.OnResult(entry, status, err)
+	}
+}
+
+// retryTokens the entry sending only to its tokens that failed with a
+// retryable error, nil when there are none
+func (this *Dispatcher) retryTokens(entry *OutboxEntry, status *FcmResponseStatus, tokenErrors map[string]error) *OutboxEntry {
+	if status == nil || len(tokenErrors) == 0 {
+		return nil
+	}
+
+	var tokens []string
+	for _, token := range entry.Message.RegistrationIds {
+		if err, failed := tokenErrors[token]; failed && this.opts.Retryable(err) {
+			tokens = append(tokens, token)
+		}
+	}
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	retry := *entry
+	retry.Message.RegistrationIds = tokens
+	retry.Delivered += status.Success + status.Duplicates
+
+	return &retry
+}
+
+// retryableSendError whether FCM may accept a failed send on a later attempt
+func retryableSendError(err error) bool {
+	switch ErrorCodeOf(err) {
+	case ErrorCode_UNAVAILABLE, ErrorCode_INTERNAL, ErrorCode_QUOTA_EXCEEDED:
+		return true
+	}
+
+	return false
+}
+
+// retryableDelivery whether a failed send of a whole entry is retried:
+// never for messages that can't be sent as they are, always for errors
+// passing Retryable, and for transport errors FCM didn't classify
+func (this *Dispatcher) retryableDelivery(err error) bool {
+	var (
+		validationErr *ValidationError
+		fieldErr      *FieldError
+		topicErr      *InvalidTopicError
+		conditionErr  *ConditionSyntaxError
+		tooLargeErr   *PayloadTooLargeError
+	)
+	switch {
+	case errors.As(err, &validationErr), errors.As(err, &fieldErr), errors.As(err, &topicErr),
+		errors.As(err, &conditionErr), errors.As(err, &tooLargeErr),
+		errors.Is(err, ErrCriticalAlertsDisabled):
+		return false
+	case this.opts.Retryable(err):
+		return true
+	}
+
+	return ErrorCodeOf(err) == ErrorCode_UNKNOWN
+}
+
+// backoff wait before the next attempt
+func (this *Dispatcher) backoff(attempts int) time.Duration {
+	return this.opts.RetryBackoff << uint(attempts-1)
+}
@@ -0,0 +1,286 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	messaging "firebase.google.com/go/v4/messaging"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func successBatchResponse() *messaging.BatchResponse {
+	return &messaging.BatchResponse{
+		SuccessCount: 1,
+		Responses: []*messaging.SendResponse{
+			{Success: true, MessageID: "123"},
+		},
+	}
+}
+
+func TestDispatcher_DeliversAndDrainsOnClose(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.Anything).Return(successBatchResponse(), nil)
+
+	c := NewFcmClient("key").SetMessagingClient(messagingClientMock)
+
+	type result struct {
+		status *FcmResponseStatus
+		err    error
+	}
+	results := make(chan result, 5)
+	d := NewDispatcher(c, NewMemoryOutbox(), DispatcherOptions{
+		Workers: 2,
+		OnResult: func(entry *OutboxEntry, status *FcmResponseStatus, err error) {
+			results <- result{status, err}
+		},
+	})
+
+	for i := 0; i < 5; i++ {
+		_, err := d.Enqueue(FcmMsg{RegistrationIds: []string{"token0"}})
+		require.Nil(t, err)
+	}
+
+	require.Nil(t, d.Close(context.Background()))
+	close(results)
+	delivered := 0
+	for result := range results {
+		require.Nil(t, result.err)
+		require.True(t, result.status.Ok)
+		delivered++
+	}
+	require.Equal(t, 5, delivered)
+	messagingClientMock.AssertNumberOfCalls(t, "SendEachForMulticast", 5)
+
+	_, err := d.Enqueue(FcmMsg{})
+	require.Equal(t, ErrDispatcherClosed, err)
+}
+
+func TestDispatcher_RetriesFailedSend(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.Anything).
+		Return((*messaging.BatchResponse)(nil), errors.New("unavailable")).Once()
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.Anything).
+		Return(successBatchResponse(), nil).Once()
+
+	c := NewFcmClient("key").SetMessagingClient(messagingClientMock)
+
+	type result struct {
+		entry *OutboxEntry
+		err   error
+	}
+	results := make(chan result, 1)
+	outbox := NewMemoryOutbox()
+	d := NewDispatcher(c, outbox, DispatcherOptions{
+		RetryBackoff: time.Millisecond,
+		PollInterval: time.Millisecond,
+		OnResult: func(entry *OutboxEntry, status *FcmResponseStatus, err error) {
+			results <- result{entry, err}
+		},
+	})
+
+	_, err := d.Enqueue(FcmMsg{RegistrationIds: []string{"token0"}})
+	require.Nil(t, err)
+
+	select {
+	case result := <-results:
+		require.Nil(t, result.err)
+		require.Equal(t, 2, result.entry.Attempts)
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not retried")
+	}
+
+	require.Nil(t, d.Close(context.Background()))
+	messagingClientMock.AssertExpectations(t)
+
+	pending, _ := outbox.Len()
+	require.Equal(t, 0, pending)
+}
+
+func TestDispatcher_DropsAfterMaxAttempts(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.Anything).
+		Return((*messaging.BatchResponse)(nil), errors.New("unavailable"))
+
+	c := NewFcmClient("key").SetMessagingClient(messagingClientMock)
+
+	results := make(chan error, 1)
+	d := NewDispatcher(c, NewMemoryOutbox(), DispatcherOptions{
+		MaxAttempts:  2,
+		RetryBackoff: time.Millisecond,
+		PollInterval: time.Millisecond,
+		OnResult: func(entry *OutboxEntry, status *FcmResponseStatus, err error) {
+			results <- err
+		},
+	})
+
+	_, err := d.Enqueue(FcmMsg{RegistrationIds: []string{"token0"}})
+	require.Nil(t, err)
+
+	select {
+	case err := <-results:
+		require.NotNil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not dropped")
+	}
+
+	require.Nil(t, d.Close(context.Background()))
+	messagingClientMock.AssertNumberOfCalls(t, "SendEachForMulticast", 2)
+}
+
+func TestDispatcher_RetriesRetryableTokens(t *testing.T) {
+	unavailable := errors.New("unavailable")
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.MatchedBy(func(message *messaging.MulticastMessage) bool {
+		return len(message.Tokens) == 3
+	})).Return(&messaging.BatchResponse{
+		SuccessCount: 1,
+		FailureCount: 2,
+		Responses: []*messaging.SendResponse{
+			{Success: true, MessageID: "1"},
+			{Error: unavailable},
+			{Error: errors.New("unregistered")},
+		},
+	}, nil).Once()
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.MatchedBy(func(message *messaging.MulticastMessage) bool {
+		return len(message.Tokens) == 1 && message.Tokens[0] == "token1"
+	})).Return(successBatchResponse(), nil).Once()
+
+	c := NewFcmClient("key").SetMessagingClient(messagingClientMock)
+
+	type result struct {
+		entry  *OutboxEntry
+		status *FcmResponseStatus
+		err    error
+	}
+	results := make(chan result, 1)
+	d := NewDispatcher(c, NewMemoryOutbox(), DispatcherOptions{
+		RetryBackoff: time.Millisecond,
+		PollInterval: time.Millisecond,
+		Retryable:    func(err error) bool { return errors.Is(err, unavailable) },
+		OnResult: func(entry *OutboxEntry, status *FcmResponseStatus, err error) {
+			results <- result{entry, status, err}
+		},
+	})
+
+	_, err := d.Enqueue(FcmMsg{RegistrationIds: []string{"token0", "token1", "token2"}})
+	require.Nil(t, err)
+
+	select {
+	case result := <-results:
+		require.Nil(t, result.err)
+		require.Equal(t, 2, result.entry.Attempts)
+		require.Equal(t, []string{"token1"}, result.entry.Message.RegistrationIds)
+		require.Equal(t, 1, result.entry.Delivered)
+		require.True(t, result.status.Ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("retryable token was not retried")
+	}
+
+	require.Nil(t, d.Close(context.Background()))
+	messagingClientMock.AssertExpectations(t)
+}
+
+func TestDispatcher_AcksNonRetryableTokenFailures(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.Anything).Return(&messaging.BatchResponse{
+		FailureCount: 1,
+		Responses:    []*messaging.SendResponse{{Error: errors.New("unregistered")}},
+	}, nil).Once()
+
+	c := NewFcmClient("key").SetMessagingClient(messagingClientMock)
+
+	results := make(chan *FcmResponseStatus, 1)
+	d := NewDispatcher(c, NewMemoryOutbox(), DispatcherOptions{
+		OnResult: func(entry *OutboxEntry, status *FcmResponseStatus, err error) {
+			results <- status
+		},
+	})
+
+	_, err := d.Enqueue(FcmMsg{RegistrationIds: []string{"token0"}})
+	require.Nil(t, err)
+	require.Nil(t, d.Close(context.Background()))
+
+	status := <-results
+	require.False(t, status.Ok)
+	require.Equal(t, 1, status.Fail)
+	messagingClientMock.AssertExpectations(t)
+}
+
+func TestDispatcher_DoesNotRetryInvalidMessages(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	c := NewFcmClient("key").SetMessagingClient(messagingClientMock)
+
+	type result struct {
+		entry *OutboxEntry
+		err   error
+	}
+	results := make(chan result, 1)
+	d := NewDispatcher(c, NewMemoryOutbox(), DispatcherOptions{
+		RetryBackoff: time.Millisecond,
+		PollInterval: time.Millisecond,
+		OnResult: func(entry *OutboxEntry, status *FcmResponseStatus, err error) {
+			results <- result{entry, err}
+		},
+	})
+
+	_, err := d.Enqueue(FcmMsg{RegistrationIds: []string{"token0"}, Data: map[string]interface{}{"title": 5}})
+	require.Nil(t, err)
+	require.Nil(t, d.Close(context.Background()))
+
+	res := <-results
+	var fieldErr *FieldError
+	require.True(t, errors.As(res.err, &fieldErr))
+	require.Equal(t, 1, res.entry.Attempts)
+	messagingClientMock.AssertNotCalled(t, "SendEachForMulticast", mock.Anything, mock.Anything)
+}
+
+// failingRequeueOutbox a MemoryOutbox failing every Put after the first
+type failingRequeueOutbox struct {
+	*MemoryOutbox
+	puts int
+}
+
+func (this *failingRequeueOutbox) Put(entry *OutboxEntry) error {
+	this.puts++
+	if this.puts > 1 {
+		return errors.New("disk full")
+	}
+
+	return this.MemoryOutbox.Put(entry)
+}
+
+func TestDispatcher_ReportsFailedRequeue(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.Anything).
+		Return((*messaging.BatchResponse)(nil), errors.New("unavailable")).Once()
+
+	c := NewFcmClient("key").SetMessagingClient(messagingClientMock)
+
+	results := make(chan error, 1)
+	outbox := &failingRequeueOutbox{MemoryOutbox: NewMemoryOutbox()}
+	d := NewDispatcher(c, outbox, DispatcherOptions{
+		Workers:      1,
+		RetryBackoff: time.Millisecond,
+		PollInterval: time.Millisecond,
+		OnResult: func(entry *OutboxEntry, status *FcmResponseStatus, err error) {
+			results <- err
+		},
+	})
+
+	_, err := d.Enqueue(FcmMsg{RegistrationIds: []string{"token0"}})
+	require.Nil(t, err)
+
+	select {
+	case err := <-results:
+		require.ErrorContains(t, err, "unavailable")
+		require.ErrorContains(t, err, "disk full")
+	case <-time.After(5 * time.Second):
+		t.Fatal("the dropped entry was not reported")
+	}
+
+	require.Nil(t, d.Close(context.Background()))
+	messagingClientMock.AssertExpectations(t)
+}
@@ -7,13 +7,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"time"
 
 	messaging "firebase.google.com/go/v4/messaging"
 	"github.com/fishbrain/go-fcm/utils"
-	logging "github.com/fishbrain/logging-go"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -43,14 +44,65 @@ var (
 	fcmServerUrl = fcm_server_url
 )
 
+// ErrSendEachNotSupported the messaging client can't send batches of
+// distinct messages, as SendEach and SendToTopics do
+var ErrSendEachNotSupported = errors.New("fcm: the messaging client doesn't implement BatchMessagingClient")
+
+// MessagingClient delivers multicast messages, e.g. a *messaging.Client
 type MessagingClient interface {
 	SendEachForMulticast(context.Context, *messaging.MulticastMessage) (*messaging.BatchResponse, error)
 }
 
+// BatchMessagingClient delivers batches of distinct messages, as needed by
+// SendEach and SendToTopics. A *messaging.Client implements it
+type BatchMessagingClient interface {
+	SendEach(context.Context, []*messaging.Message) (*messaging.BatchResponse, error)
+}
+
 // FcmClient stores the key and the Message (FcmMsg)
 type FcmClient struct {
 	ApiKey  string
 	Message FcmMsg
+
+	// Messaging when set is used to deliver messages, instead of
+	// authorizing a new Firebase messaging client on every Send
+	Messaging MessagingClient
+
+	// Idempotency when set skips sends already completed
+	// within IdempotencyWindow, see SetIdempotencyKey
+	Idempotency       IdempotencyStore
+	IdempotencyWindow time.Duration
+
+	// StrictValidation when set Send refuses messages failing Validate
+	StrictValidation bool
+
+	// Localizer when set translates notification loc keys per recipient locale
+	Localizer *Localizer
+
+	// Templates the notification templates of SendTemplate
+	Templates *TemplateRegistry
+
+	// Badges when set counts the unread notifications of every token,
+	// sent as its badge
+	Badges BadgeCounter
+
+	// CriticalAlerts opts in to iOS critical sounds, see SetCriticalSound
+	CriticalAlerts bool
+
+	// Metrics when set receives the send counts, failures and latencies
+	Metrics Metrics
+
+	// TracerProvider when set records OpenTelemetry spans of the sends
+	TracerProvider trace.TracerProvider
+
+	// Interceptors wrap every send, see SetInterceptors
+	Interceptors []Interceptor
+
+	// Logger when set receives the logs of the client, nothing is logged without one
+	Logger *slog.Logger
+
+	// Redactor hides tokens and credentials in logs and errors, DefaultRedactor when not set
+	Redactor *Redactor
 }
 
 // FcmMsg represents fcm request message
@@ -68,6 +120,19 @@ type FcmMsg struct {
 	DryRun                bool                 `json:"dry_run,omitempty"`
 	Condition             string               `json:"condition,omitempty"`
 	MutableContent        bool                 `json:"mutable_content,omitempty"`
+	DeliveryWindow        *DeliveryWindow      `json:"delivery_window,omitempty"`
+	TimeZones             map[string]string    `json:"time_zones,omitempty"`
+	Urgent                bool                 `json:"urgent,omitempty"`
+	IdempotencyKey        string               `json:"idempotency_key,omitempty"`
+	TokenIdempotencyKeys  map[string]string    `json:"token_idempotency_keys,omitempty"`
+	TrimmableKeys         []string             `json:"trimmable_keys,omitempty"`
+	Locales               map[string]string    `json:"locales,omitempty"`
+	ActionCategory        string               `json:"action_category,omitempty"`
+	Actions               []NotificationAction `json:"actions,omitempty"`
+	Sound                 *SoundConfig         `json:"sound,omitempty"`
+	APNS                  *APNSOptions         `json:"apns,omitempty"`
+	Android               *AndroidOptions      `json:"android,omitempty"`
+	AnalyticsLabel        string               `json:"analytics_label,omitempty"`
 }
 
 // FcmMsg represents fcm response message - (tokens and topics)
@@ -82,27 +147,29 @@ type FcmResponseStatus struct {
 	MsgId         int64               `json:"message_id,omitempty"`
 	Err           string              `json:"error,omitempty"`
 	RetryAfter    string
+	// Duplicates tokens skipped because their send already completed
+	Duplicates int `json:"duplicates,omitempty"`
 }
 
 // NotificationPayload notification message payload
 type NotificationPayload struct {
-	Title            string `json:"title,omitempty"`
-	Body             string `json:"body,omitempty"`
-	Icon             string `json:"icon,omitempty"`
-	Sound            string `json:"sound,omitempty"`
-	Badge            string `json:"badge,omitempty"`
-	Image            string `json:"image,omitempty"`
-	Tag              string `json:"tag,omitempty"`
-	Color            string `json:"color,omitempty"`
-	ClickAction      string `json:"click_action,omitempty"`
-	BodyLocKey       string `json:"body_loc_key,omitempty"`
-	BodyLocArgs      string `json:"body_loc_args,omitempty"`
-	TitleLocKey      string `json:"title_loc_key,omitempty"`
-	TitleLocArgs     string `json:"title_loc_args,omitempty"`
-	AndroidChannelID string `json:"android_channel_id,omitempty"`
-}
-
-var authAndGetFcmClient = utils.AuthorizeAndGetfcmClientFromKey
+	Title            string   `json:"title,omitempty"`
+	Body             string   `json:"body,omitempty"`
+	Icon             string   `json:"icon,omitempty"`
+	Sound            string   `json:"sound,omitempty"`
+	Badge            string   `json:"badge,omitempty"`
+	Image            string   `json:"image,omitempty"`
+	Tag              string   `json:"tag,omitempty"`
+	Color            string   `json:"color,omitempty"`
+	ClickAction      string   `json:"click_action,omitempty"`
+	BodyLocKey       string   `json:"body_loc_key,omitempty"`
+	BodyLocArgs      []string `json:"body_loc_args,omitempty"`
+	TitleLocKey      string   `json:"title_loc_key,omitempty"`
+	TitleLocArgs     []string `json:"title_loc_args,omitempty"`
+	AndroidChannelID string   `json:"android_channel_id,omitempty"`
+}
+
+var authAndGetFcmClient = utils.AuthorizeAndGetfcmClientFromKeyWithLogger
 
 // NewFcmClient init and create fcm client
 func NewFcmClient(apiKey string) *FcmClient {
@@ -119,8 +186,13 @@ func (this *FcmClient) NewFcmTopicMsg(to string, body map[string]string) *FcmCli
 	return this
 }
 
-// NewFcmMsgTo sets the targeted token/topic and the data payload
+// NewFcmMsgTo sets the targeted token/topic and the data payload.
+// Topics ("/topics/name") are normalised, Send and Validate fail with an
+// *InvalidTopicError for invalid topic names
 func (this *FcmClient) NewFcmMsgTo(to string, body interface{}) *FcmClient {
+	if topic, err := ParseTopic(to); err == nil && isTopicTarget(to) {
+		to = topic.Path()
+	}
 	this.Message.To = to
 	this.Message.Data = body
 
@@ -142,6 +214,64 @@ func (this *FcmClient) NewFcmRegIdsMsg(list []string, body interface{}) *FcmClie
 	return this
 }
 
+// SetMessagingClient sets the client used to deliver messages, e.g. a
+// *messaging.Client that is authorized once and shared between sends
+func (this *FcmClient) SetMessagingClient(client MessagingClient) *FcmClient {
+	this.Messaging = client
+
+	return this
+}
+
+// messagingClient the client delivering messages, authorizing one when none is set
+func (this *FcmClient) messagingClient(ctx context.Context) (MessagingClient, error) {
+	if this.Messaging != nil {
+		return this.instrument(this.Messaging), nil
+	}
+
+	client, err := this.authorize(ctx, credentials_key, authAndGetFcmClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return this.instrument(client), nil
+}
+
+// batchMessagingClient the client delivering batches of messages,
+// ErrSendEachNotSupported when the set client can't
+func (this *FcmClient) batchMessagingClient(ctx context.Context) (BatchMessagingClient, error) {
+	if this.Messaging != nil {
+		if _, ok := this.Messaging.(BatchMessagingClient); !ok {
+			return nil, fmt.Errorf("%w, got %T", ErrSendEachNotSupported, this.Messaging)
+		}
+	}
+
+	client, err := this.messagingClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.(BatchMessagingClient), nil
+}
+
+// sendEachWith sends messages with client, ErrSendEachNotSupported when
+// it can't send batches
+func sendEachWith(ctx context.Context, client MessagingClient, messages []*messaging.Message) (*messaging.BatchResponse, error) {
+	batchClient, ok := client.(BatchMessagingClient)
+	if !ok {
+		return nil, fmt.Errorf("%w, got %T", ErrSendEachNotSupported, client)
+	}
+
+	return batchClient.SendEach(ctx, messages)
+}
+
+// withMessage returns a copy of the client holding the given message
+func (this *FcmClient) withMessage(msg FcmMsg) *FcmClient {
+	client := *this
+	client.Message = msg
+
+	return &client
+}
+
 // newDevicesList init the devices list
 func (this *FcmClient) newDevicesList(list []string) *FcmClient {
 	this.Message.RegistrationIds = make([]string, len(list))
@@ -208,85 +338,129 @@ func (this *FcmClient) sendOnce() (*FcmResponseStatus, error) {
 
 // Send to fcm
 func (this *FcmClient) Send() (*FcmResponseStatus, error) {
+	return this.send(context.Background())
+}
+
+// send sends the message within a span
+func (this *FcmClient) send(ctx context.Context) (*FcmResponseStatus, error) {
+	ctx, span := this.startSpan(ctx, span_send, attr_tokens.Int(len(this.Message.RegistrationIds)))
+	status, err := this.sendMessage(ctx)
+	err = this.redactor().Error(err, this.Message.RegistrationIds...)
+	endSpan(span, err, statusAttributes(status)...)
+
+	return status, err
+}
+
+// sendMessage sends the message with the client messaging client, or
+// authorizes one
+func (this *FcmClient) sendMessage(ctx context.Context) (*FcmResponseStatus, error) {
+	if err := this.Message.topicError(); err != nil {
+		return &FcmResponseStatus{}, err
+	}
+	if err := this.Message.idempotencyTargetError(); err != nil {
+		return &FcmResponseStatus{}, err
+	}
+
+	if this.StrictValidation {
+		if err := this.Validate(); err != nil {
+			return &FcmResponseStatus{}, err
+		}
+	}
+
+	if this.Messaging != nil {
+		return this.sendOnceContext(ctx, this.Messaging)
+	}
 
 	if this.Message.DryRun {
-		logging.Log.Info("Dry run mode enabled")
+		logger := this.logger()
+		logger.Debug("dry run mode enabled")
 
-		client, err := utils.AuthorizeAndGetFirebaseMessagingClient()
+		client, err := this.authorize(ctx, credentials_embedded, utils.AuthorizeAndGetFirebaseMessagingClientWithLogger)
 		if err != nil {
-			logging.Log.Infof("Error getting messaging client with embedded key: %s", err)
+			logger.Warn("error getting messaging client", "credentials", credentials_embedded, "error", err)
 		}
-		logging.Log.Infof("FCM Client with embedded key: %v", client)
 
-		response, err := this.sendOnceFirebaseAdminGo(client)
+		response, err := this.sendOnceContext(ctx, client)
 		if response.Ok {
-			logging.Log.Infof("Success sending message with embedded key")
+			logger.Debug("sent message", "credentials", credentials_embedded)
 			return response, err
-		}else {
-			logging.Log.Infof("Error sending message with embedded key %v", response)
+		} else {
+			logger.Warn("error sending message", "credentials", credentials_embedded, "error", err)
 		}
 
-		client, err = utils.AuthorizeAndGetfcmClientFromIdPoolKey()
+		client, err = this.authorize(ctx, credentials_id_pool, utils.AuthorizeAndGetfcmClientFromIdPoolKeyWithLogger)
 		if err != nil {
-			logging.Log.Infof("Error getting messaging client with key as a map: %s", err)
+			logger.Warn("error getting messaging client", "credentials", credentials_id_pool, "error", err)
 		}
-		logging.Log.Infof("FCM Client with key as a map: %v", client)
 
-		response, err = this.sendOnceFirebaseAdminGo(client)
-		
-		if response.Ok{
-			logging.Log.Infof("Success sending message with key as a map")
+		response, err = this.sendOnceContext(ctx, client)
+		if response.Ok {
+			logger.Debug("sent message", "credentials", credentials_id_pool)
 			return response, err
-		}else {
-			logging.Log.Infof("Error sending message with key as a map %v", response)
+		} else {
+			logger.Warn("error sending message", "credentials", credentials_id_pool, "error", err)
 		}
 	}
 
-	client, err := authAndGetFcmClient()
-		if err != nil {
-			logging.Log.Errorf("Error getting messaging client: %s", err)
-			return &FcmResponseStatus{}, err
-		}
+	client, err := this.authorize(ctx, credentials_key, authAndGetFcmClient)
+	if err != nil {
+		this.logger().Error("error getting messaging client", "credentials", credentials_key, "error", err)
+		return &FcmResponseStatus{}, err
+	}
 
-	return this.sendOnceFirebaseAdminGo(client)
+	return this.sendOnceContext(ctx, client)
 }
 
 func (fcmClient *FcmClient) sendOnceFirebaseAdminGo(client MessagingClient) (*FcmResponseStatus, error) {
-	multicastMessage, ok := fcmClient.Message.makeMulticastMessageData()
-	if !ok {
-		return nil, errors.New("error building multicast message for Firebase Admin Go library")
+	return fcmClient.sendOnceContext(context.Background(), client)
+}
+
+// sendOnceContext sends the message with client, within the span of ctx
+func (fcmClient *FcmClient) sendOnceContext(ctx context.Context, client MessagingClient) (*FcmResponseStatus, error) {
+	if err := fcmClient.checkCriticalAlerts(&fcmClient.Message); err != nil {
+		return &FcmResponseStatus{}, err
 	}
+	client = fcmClient.instrument(client)
 
-	message := &messaging.MulticastMessage{
-		Data:   *multicastMessage,
-		Tokens: fcmClient.Message.RegistrationIds,
+	message, err := fcmClient.Message.makeMulticastMessage()
+	if err != nil {
+		return &FcmResponseStatus{}, err
 	}
-	
-	if fcmClient.Message.Notification != nil {
-		message.Notification = &messaging.Notification{
-			Title: fcmClient.Message.Notification.Title,
-			Body:  fcmClient.Message.Notification.Body,
-		}
 
-		message.APNS = &messaging.APNSConfig{
-			Payload: &messaging.APNSPayload{
-				Aps: fcmClient.Message.Notification.asAPS(),
-			},
-		} 
+	if err := fcmClient.Message.fitPayload(message); err != nil {
+		return &FcmResponseStatus{}, err
+	}
 
-		imageUrlField := fcmClient.Message.Notification.Image
-		if imageUrlField != "" {
-			message = addImageURLToMulticastMessage(message, imageUrlField)
-			}
+	tokens, duplicates, err := fcmClient.skipDuplicates(message.Tokens)
+	if err != nil {
+		return &FcmResponseStatus{}, err
+	}
+	if duplicates > 0 && len(tokens) == 0 {
+		return &FcmResponseStatus{
+			Ok:         true,
+			StatusCode: http.StatusOK,
+			Duplicates: duplicates,
+		}, nil
 	}
+	message.Tokens = tokens
 
-	batchResponse, err := client.SendEachForMulticast(context.Background(), message)
+	batchResponse, err := fcmClient.sendMulticast(ctx, client, message)
 	if err != nil {
-		logging.Log.Errorf("Error sending message: %s", err)
+		fcmClient.logger().Error("error sending message", "tokens", len(message.Tokens), "error", err)
+		if err := fcmClient.completeSends(tokens, nil); err != nil {
+			fcmClient.logger().Error("error releasing idempotency keys", "error", err)
+		}
 		return &FcmResponseStatus{}, err
 	}
 
 	fcmRespStatus := toFcmRespStatus(batchResponse)
+	fcmRespStatus.Duplicates = duplicates
+	recordTokenErrors(ctx, tokens, batchResponse)
+	fcmClient.logger().Debug("sent message", "success", fcmRespStatus.Success, "failure", fcmRespStatus.Fail, "duplicates", duplicates)
+
+	if err := fcmClient.completeSends(tokens, batchResponse); err != nil {
+		fcmClient.logger().Error("error storing idempotency keys", "error", err)
+	}
 
 	return fcmRespStatus, nil
 }
@@ -296,19 +470,25 @@ func (n *NotificationPayload) asAPS() *messaging.Aps {
 	if err != nil {
 		return &messaging.Aps{
 			Sound: n.Sound,
-			Alert: &messaging.ApsAlert{
-				Body: n.Body,
-				Title: n.Title,
-			},
+			Alert: n.asApsAlert(),
 		}
 	}
 	return &messaging.Aps{
 		Badge: &badge,
 		Sound: n.Sound,
-		Alert: &messaging.ApsAlert{
-			Body: n.Body,
-			Title: n.Title,
-		},
+		Alert: n.asApsAlert(),
+	}
+}
+
+// asApsAlert the APNs alert, with the loc keys for the app to localise
+func (n *NotificationPayload) asApsAlert() *messaging.ApsAlert {
+	return &messaging.ApsAlert{
+		Body:         n.Body,
+		Title:        n.Title,
+		LocKey:       n.BodyLocKey,
+		LocArgs:      n.BodyLocArgs,
+		TitleLocKey:  n.TitleLocKey,
+		TitleLocArgs: n.TitleLocArgs,
 	}
 }
 
@@ -416,20 +596,10 @@ func (this *FcmClient) SetMutableContent(mc bool) *FcmClient {
 	return this
 }
 
-// PrintResults prints the FcmResponseStatus results for fast using and debugging
+// PrintResults prints the FcmResponseStatus results for fast using and debugging,
+// redacted by DefaultRedactor
 func (this *FcmResponseStatus) PrintResults() {
-	fmt.Println("Status Code   :", this.StatusCode)
-	fmt.Println("Success       :", this.Success)
-	fmt.Println("Fail          :", this.Fail)
-	fmt.Println("Canonical_ids :", this.Canonical_ids)
-	fmt.Println("Topic MsgId   :", this.MsgId)
-	fmt.Println("Topic Err     :", this.Err)
-	for i, val := range this.Results {
-		fmt.Printf("Result(%d)> \n", i)
-		for k, v := range val {
-			fmt.Println("\t", k, " : ", v)
-		}
-	}
+	printResults(this)
 }
 
 // IsTimeout check whether the response timeout based on http response status
@@ -1,68 +1,74 @@
 package fcm
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 
 	messaging "firebase.google.com/go/v4/messaging"
 )
 
-func (this *FcmMsg) makeMulticastMessageData() (*map[string]string, bool) {
-	if this.Data == nil {
-		emptyMap := make(map[string]string)
-		return &emptyMap, true
-	}
+// data_string_fields the data fields sent as they are, which must be strings
+var data_string_fields = []string{"title", "body", "item_type", "item_id", "deeplink", "image_url", "sound", "actor_nickname"}
 
-	data, ok := this.Data.(map[string]interface{})
-	dataMap := make(map[string]string)
-	if !ok {
+// makeMulticastMessageData the data payload of the message, false when it
+// can't be built, see multicastMessageData
+func (this *FcmMsg) makeMulticastMessageData() (*map[string]string, bool) {
+	dataMap, err := this.multicastMessageData()
+	if err != nil {
 		return nil, false
 	}
 
-	titleField, ok := data["title"]
-	if ok {
-		dataMap["title"] = titleField.(string)
-	}
-
-	bodyField, ok := data["body"]
-	if ok {
-		dataMap["body"] = bodyField.(string)
-	}
-
-	itemTypeField, ok := data["item_type"]
-	if ok {
-		dataMap["item_type"] = itemTypeField.(string)
-	}
-
-	itemIdField, ok := data["item_id"]
-	if ok {
-		dataMap["item_id"] = itemIdField.(string)
-	}
+	return &dataMap, true
+}
 
-	deepLinkField, ok := data["deeplink"]
-	if ok {
-		dataMap["deeplink"] = deepLinkField.(string)
+// multicastMessageData the data payload of the message, a *FieldError when
+// a data value has the wrong type
+func (this *FcmMsg) multicastMessageData() (map[string]string, error) {
+	if this.Data == nil {
+		return make(map[string]string), nil
 	}
 
-	imageUrlField, ok := data["image_url"]
-	if ok {
-		dataMap["image_url"] = imageUrlField.(string)
+	switch appData := this.Data.(type) {
+	case *AppData:
+		return appData.ToMap(), nil
+	case AppData:
+		return appData.ToMap(), nil
+	case map[string]string:
+		dataMap := make(map[string]string, len(appData))
+		for key, value := range appData {
+			dataMap[key] = value
+		}
+		return dataMap, nil
 	}
 
-	soundField, ok := data["sound"]
-	if ok {
-		dataMap["sound"] = soundField.(string)
+	data, ok := this.Data.(map[string]interface{})
+	if !ok {
+		return nil, &FieldError{Field: "data", Message: fmt.Sprintf("must be a map[string]interface{}, map[string]string or *AppData, got %T", this.Data)}
 	}
 
-	actorNicknameField, ok := data["actor_nickname"]
-	if ok {
-		dataMap["actor_nickname"] = actorNicknameField.(string)
+	dataMap := make(map[string]string)
+	for _, key := range data_string_fields {
+		field, ok := data[key]
+		if !ok {
+			continue
+		}
+		value, ok := field.(string)
+		if !ok {
+			return nil, &FieldError{Field: "data." + key, Message: fmt.Sprintf("must be a string, got %T", field)}
+		}
+		dataMap[key] = value
 	}
 
 	badgeCountField, ok := data["badge_count"]
 	if ok {
-		dataMap["badge_count"] = strconv.Itoa(int(badgeCountField.(float64)))
+		badgeCount, ok := badgeCountString(badgeCountField)
+		if !ok {
+			return nil, &FieldError{Field: "data.badge_count", Message: fmt.Sprintf("must be a number, got %v", badgeCountField)}
+		}
+		dataMap["badge_count"] = badgeCount
 	}
 
 	actionsField, ok := data["actions"]
@@ -81,7 +87,88 @@ func (this *FcmMsg) makeMulticastMessageData() (*map[string]string, bool) {
 		}
 	}
 
-	return &dataMap, true
+	return dataMap, nil
+}
+
+// makeMulticastMessage builds the Firebase Admin Go message sent to the RegistrationIds
+func (this *FcmMsg) makeMulticastMessage() (*messaging.MulticastMessage, error) {
+	data, err := this.multicastMessageData()
+	if err != nil {
+		return nil, fmt.Errorf("fcm: error building multicast message for Firebase Admin Go library: %w", err)
+	}
+
+	message := &messaging.MulticastMessage{
+		Data:   data,
+		Tokens: this.RegistrationIds,
+	}
+
+	if this.Notification != nil {
+		message.Notification = &messaging.Notification{
+			Title: this.Notification.Title,
+			Body:  this.Notification.Body,
+		}
+
+		message.APNS = &messaging.APNSConfig{
+			Payload: &messaging.APNSPayload{
+				Aps: this.Notification.asAPS(),
+			},
+		}
+
+		imageUrlField := this.Notification.Image
+		if imageUrlField != "" {
+			message = addImageURLToMulticastMessage(message, imageUrlField)
+		}
+
+		if this.Notification.TitleLocKey != "" || this.Notification.BodyLocKey != "" {
+			androidNotification := ensureAndroidNotification(message)
+			androidNotification.TitleLocKey = this.Notification.TitleLocKey
+			androidNotification.TitleLocArgs = this.Notification.TitleLocArgs
+			androidNotification.BodyLocKey = this.Notification.BodyLocKey
+			androidNotification.BodyLocArgs = this.Notification.BodyLocArgs
+		}
+
+		if this.Sound != nil {
+			this.Sound.applySound(message)
+		}
+
+		if this.APNS != nil {
+			this.APNS.applyAPNS(message.APNS.Payload.Aps)
+		}
+
+		if this.Android != nil {
+			this.Android.applyAndroid(ensureAndroidNotification(message))
+		}
+	}
+
+	this.applyActions(message)
+	this.applyAnalyticsLabel(message)
+
+	return message, nil
+}
+
+// ensureAndroidNotification the Android notification of the message,
+// created when missing
+func ensureAndroidNotification(message *messaging.MulticastMessage) *messaging.AndroidNotification {
+	if message.Android == nil {
+		message.Android = &messaging.AndroidConfig{}
+	}
+	if message.Android.Notification == nil {
+		message.Android.Notification = &messaging.AndroidNotification{}
+	}
+
+	return message.Android.Notification
+}
+
+// toMessage copies the multicast payload into a message without a target
+func toMessage(multicastMessage *messaging.MulticastMessage) *messaging.Message {
+	return &messaging.Message{
+		Data:         multicastMessage.Data,
+		Notification: multicastMessage.Notification,
+		Android:      multicastMessage.Android,
+		Webpush:      multicastMessage.Webpush,
+		APNS:         multicastMessage.APNS,
+		FCMOptions:   multicastMessage.FCMOptions,
+	}
 }
 
 func addImageURLToMulticastMessage(multicastMessage *messaging.MulticastMessage, imageURL string) (*messaging.MulticastMessage) {	
@@ -123,6 +210,31 @@ func toFcmRespStatus(resp *messaging.BatchResponse) *FcmResponseStatus {
 	return &status
 }
 
+// tokenErrorsKey context key of the map recordTokenErrors records into
+type tokenErrorsKey struct{}
+
+// withTokenErrors a context recording the errors of the failed sends
+// into errs, by token
+func withTokenErrors(ctx context.Context, errs map[string]error) context.Context {
+	return context.WithValue(ctx, tokenErrorsKey{}, errs)
+}
+
+// recordTokenErrors records the errors of the failed sends, the responses
+// being in the order of the tokens, when ctx has a map to record into
+func recordTokenErrors(ctx context.Context, tokens []string, resp *messaging.BatchResponse) {
+	errs, ok := ctx.Value(tokenErrorsKey{}).(map[string]error)
+	if !ok {
+		return
+	}
+
+	for i, result := range resp.Responses {
+		if i >= len(tokens) || result == nil || result.Success {
+			continue
+		}
+		errs[tokens[i]] = result.Error
+	}
+}
+
 func toFcmResponseResults(original *[]*messaging.SendResponse) *[]map[string]string {
 	var result []map[string]string
 	var elem map[string]string
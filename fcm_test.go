@@ -6,11 +6,9 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
 
 	messaging "firebase.google.com/go/v4/messaging"
-	logging "github.com/fishbrain/logging-go"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
@@ -19,16 +17,16 @@ type fcmMock struct {
 	mock.Mock
 }
 
-func TestMain(m *testing.M) {
-	logging.Init(logging.LoggingConfig{})
-	os.Exit(m.Run())
-}
-
 func (m *fcmMock) SendEachForMulticast(ctx context.Context, mm *messaging.MulticastMessage) (*messaging.BatchResponse, error) {
 	args := m.Called(ctx, mm)
 	return args.Get(0).(*messaging.BatchResponse), args.Error(1)
 }
 
+func (m *fcmMock) SendEach(ctx context.Context, messages []*messaging.Message) (*messaging.BatchResponse, error) {
+	args := m.Called(ctx, messages)
+	return args.Get(0).(*messaging.BatchResponse), args.Error(1)
+}
+
 func TestTopicHandle_1(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(topicHandle))
 	chgUrl(srv)
@@ -216,7 +214,6 @@ func regIdHandle(w http.ResponseWriter, r *http.Request) {
 }
 
 func TestSendFirebase(t *testing.T) {
-	logging.Init(logging.LoggingConfig{})
 	srv := httptest.NewServer(http.HandlerFunc(regIdHandle))
 	chgUrl(srv)
 	defer srv.Close()
@@ -257,7 +254,6 @@ func TestSendFirebase(t *testing.T) {
 }
 
 func TestSendOnceFirebaseAdminGo_SuccessResponse(t *testing.T) {
-	logging.Init(logging.LoggingConfig{})
 	c := NewFcmClient("key")
 
 	notificationPayload := NotificationPayload{
@@ -308,7 +304,6 @@ func TestSendOnceFirebaseAdminGo_SuccessResponse(t *testing.T) {
 }
 
 func TestSendOnceFirebaseAdminGo_SuccessResponseWhenNoNotificationPayload(t *testing.T) {
-	logging.Init(logging.LoggingConfig{})
 	c := NewFcmClient("key")
 
 	messagingClientMock := new(fcmMock)
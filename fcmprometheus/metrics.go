@@ -0,0 +1,144 @@
+// Package fcmprometheus reports the fcm client metrics as Prometheus collectors
+package fcmprometheus
+
+import (
+	"strconv"
+	"time"
+
+	fcm "github.com/fishbrain/go-fcm"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// default_namespace prefix of the metric names
+	default_namespace = "fcm"
+	// code_error the code label of Instance ID calls failing without a response
+	code_error = "error"
+)
+
+// Options configure the collectors, zero values use the defaults
+type Options struct {
+	// Namespace prefix of the metric names, default "fcm"
+	Namespace string
+	// ConstLabels labels added to every metric, e.g. the app
+	ConstLabels prometheus.Labels
+	// Buckets of the latency histograms, default prometheus.DefBuckets
+	Buckets []float64
+}
+
+var _ fcm.Metrics = (*Metrics)(nil)
+
+// Metrics an fcm.Metrics exposing Prometheus collectors. Register it
+// once, e.g. prometheus.MustRegister(metrics), and set it on the
+// clients with SetMetrics.
+type Metrics struct {
+	messages          *prometheus.CounterVec
+	tokens            *prometheus.CounterVec
+	failures          *prometheus.CounterVec
+	batchLatency      *prometheus.HistogramVec
+	retries           prometheus.Counter
+	instanceID        *prometheus.CounterVec
+	instanceIDLatency *prometheus.HistogramVec
+}
+
+// New creates the collectors
+func New(opts Options) *Metrics {
+	if opts.Namespace == "" {
+		opts.Namespace = default_namespace
+	}
+	if opts.Buckets == nil {
+		opts.Buckets = prometheus.DefBuckets
+	}
+
+	counter := func(name string, help string, labels ...string) *prometheus.CounterVec {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   opts.Namespace,
+			Name:        name,
+			Help:        help,
+			ConstLabels: opts.ConstLabels,
+		}, labels)
+	}
+	histogram := func(name string, help string) *prometheus.HistogramVec {
+		return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   opts.Namespace,
+			Name:        name,
+			Help:        help,
+			ConstLabels: opts.ConstLabels,
+			Buckets:     opts.Buckets,
+		}, []string{"operation"})
+	}
+
+	return &Metrics{
+		messages:     counter("messages_attempted_total", "Messages handed to FCM.", "operation"),
+		tokens:       counter("tokens_attempted_total", "Tokens targeted by the messages handed to FCM.", "operation"),
+		failures:     counter("send_failures_total", "Failed sends by FCM error code.", "operation", "code"),
+		batchLatency: histogram("batch_latency_seconds", "Latency of the calls to FCM."),
+		retries: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   opts.Namespace,
+			Name:        "retries_total",
+			Help:        "Delivery retries of the dispatcher.",
+			ConstLabels: opts.ConstLabels,
+		}),
+		instanceID:        counter("instance_id_calls_total", "Instance ID calls by HTTP status code, \"error\" without a response.", "operation", "code"),
+		instanceIDLatency: histogram("instance_id_latency_seconds", "Latency of the Instance ID calls."),
+	}
+}
+
+// collectors every collector of the metrics
+func (this *Metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		this.messages,
+		this.tokens,
+		this.failures,
+		this.batchLatency,
+		this.retries,
+		this.instanceID,
+		this.instanceIDLatency,
+	}
+}
+
+// Describe implements prometheus.Collector
+func (this *Metrics) Describe(descs chan<- *prometheus.Desc) {
+	for _, collector := range this.collectors() {
+		collector.Describe(descs)
+	}
+}
+
+// Collect implements prometheus.Collector
+func (this *Metrics) Collect(metrics chan<- prometheus.Metric) {
+	for _, collector := range this.collectors() {
+		collector.Collect(metrics)
+	}
+}
+
+// Attempted implements fcm.Metrics
+func (this *Metrics) Attempted(operation string, messages int, tokens int) {
+	this.messages.WithLabelValues(operation).Add(float64(messages))
+	this.tokens.WithLabelValues(operation).Add(float64(tokens))
+}
+
+// Failed implements fcm.Metrics
+func (this *Metrics) Failed(operation string, code fcm.ErrorCode, count int) {
+	this.failures.WithLabelValues(operation, string(code)).Add(float64(count))
+}
+
+// BatchLatency implements fcm.Metrics
+func (this *Metrics) BatchLatency(operation string, latency time.Duration) {
+	this.batchLatency.WithLabelValues(operation).Observe(latency.Seconds())
+}
+
+// Retried implements fcm.Metrics
+func (this *Metrics) Retried(attempt int) {
+	this.retries.Inc()
+}
+
+// InstanceIDCall implements fcm.Metrics
+func (this *Metrics) InstanceIDCall(operation string, statusCode int, err error, latency time.Duration) {
+	code := code_error
+	if err == nil {
+		code = strconv.Itoa(statusCode)
+	}
+
+	this.instanceID.WithLabelValues(operation, code).Inc()
+	this.instanceIDLatency.WithLabelValues(operation).Observe(latency.Seconds())
+}
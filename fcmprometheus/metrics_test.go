@@ -0,0 +1,89 @@
+package fcmprometheus
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	messaging "firebase.google.com/go/v4/messaging"
+	fcm "github.com/fishbrain/go-fcm"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type stubMessagingClient struct{}
+
+func (stubMessagingClient) SendEachForMulticast(ctx context.Context, message *messaging.MulticastMessage) (*messaging.BatchResponse, error) {
+	return &messaging.BatchResponse{
+		SuccessCount: 1,
+		FailureCount: 1,
+		Responses: []*messaging.SendResponse{
+			{Success: true, MessageID: "123"},
+			{Error: errors.New("bad token")},
+		},
+	}, nil
+}
+
+func (stubMessagingClient) SendEach(ctx context.Context, messages []*messaging.Message) (*messaging.BatchResponse, error) {
+	return nil, errors.New("down")
+}
+
+func TestMetrics_Scrape(t *testing.T) {
+	metrics := New(Options{Buckets: []float64{1}})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metrics)
+
+	c := fcm.NewFcmClient("key").
+		SetMessagingClient(stubMessagingClient{}).
+		SetMetrics(metrics).
+		NewFcmRegIdsMsg([]string{"token0", "token1"}, nil)
+	_, err := c.Send()
+	require.Nil(t, err)
+
+	metrics.Retried(2)
+	metrics.InstanceIDCall(fcm.Operation_GET_INFO, 200, nil, time.Millisecond)
+	metrics.InstanceIDCall(fcm.Operation_GET_INFO, 0, errors.New("refused"), time.Millisecond)
+
+	expected := `
+# HELP fcm_messages_attempted_total Messages handed to FCM.
+# TYPE fcm_messages_attempted_total counter
+fcm_messages_attempted_total{operation="multicast"} 1
+# HELP fcm_tokens_attempted_total Tokens targeted by the messages handed to FCM.
+# TYPE fcm_tokens_attempted_total counter
+fcm_tokens_attempted_total{operation="multicast"} 2
+# HELP fcm_send_failures_total Failed sends by FCM error code.
+# TYPE fcm_send_failures_total counter
+fcm_send_failures_total{code="unknown",operation="multicast"} 1
+# HELP fcm_retries_total Delivery retries of the dispatcher.
+# TYPE fcm_retries_total counter
+fcm_retries_total 1
+# HELP fcm_instance_id_calls_total Instance ID calls by HTTP status code, "error" without a response.
+# TYPE fcm_instance_id_calls_total counter
+fcm_instance_id_calls_total{code="200",operation="get_info"} 1
+fcm_instance_id_calls_total{code="error",operation="get_info"} 1
+`
+	require.Nil(t, testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"fcm_messages_attempted_total", "fcm_tokens_attempted_total", "fcm_send_failures_total",
+		"fcm_retries_total", "fcm_instance_id_calls_total"))
+
+	require.Equal(t, 1, testutil.CollectAndCount(metrics.batchLatency))
+	require.Equal(t, 1, testutil.CollectAndCount(metrics.instanceIDLatency))
+}
+
+func TestMetrics_Options(t *testing.T) {
+	metrics := New(Options{Namespace: "push", ConstLabels: prometheus.Labels{"app": "fishbrain"}})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metrics)
+
+	metrics.Retried(2)
+
+	expected := `
+# HELP push_retries_total Delivery retries of the dispatcher.
+# TYPE push_retries_total counter
+push_retries_total{app="fishbrain"} 1
+`
+	require.Nil(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "push_retries_total"))
+}
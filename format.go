@@ -0,0 +1,398 @@
+package fcm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Format the layout a ResultFormatter writes results in
+type Format string
+
+const (
+	// Format_TEXT one "Label : value" line per field, then the fields of
+	// every per-token result
+	Format_TEXT Format = "text"
+	// Format_TABLE the fields aligned, then the per-token results as a table
+	Format_TABLE Format = "table"
+	// Format_JSON_LINES one JSON object per result, for log pipelines
+	Format_JSON_LINES Format = "jsonl"
+)
+
+// ResultFormatter writes the results of the client (FcmResponseStatus,
+// SendEachResult, TopicsSendResult, TemplateSendResult) and of the Instance
+// ID calls (InstanceIdInfoResponse, SubscribeResponse, BatchResponse,
+// ApnsBatchResponse) to a writer, with the tokens redacted
+type ResultFormatter struct {
+	Format Format
+	// Redactor redacts the tokens and errors, DefaultRedactor when not set
+	Redactor *Redactor
+}
+
+// NewResultFormatter creates a formatter writing in format
+func NewResultFormatter(format Format) *ResultFormatter {
+	return &ResultFormatter{Format: format}
+}
+
+// resultField a field of a result, Label in text and tables and Key in JSON
+type resultField struct {
+	Label string
+	Key   string
+	Value interface{}
+}
+
+// resultRecord a result prepared for formatting, already redacted
+type resultRecord struct {
+	// Type the "type" of the JSON object
+	Type   string
+	Fields []resultField
+	// Items the per-token, recipient or topic group results
+	Items [][]resultField
+}
+
+// formattableResult a result a ResultFormatter can write
+type formattableResult interface {
+	resultRecord(redactor *Redactor) *resultRecord
+}
+
+// Write writes result to w
+func (this *ResultFormatter) Write(w io.Writer, result interface{}) error {
+	formattable, ok := result.(formattableResult)
+	if !ok {
+		return fmt.Errorf("fcm: can't format results of type %T", result)
+	}
+
+	redactor := this.Redactor
+	if redactor == nil {
+		redactor = DefaultRedactor
+	}
+	record := formattable.resultRecord(redactor)
+
+	switch this.Format {
+	case Format_TEXT, "":
+		return writeText(w, record)
+	case Format_TABLE:
+		return writeTable(w, record)
+	case Format_JSON_LINES:
+		return writeJSONLine(w, record)
+	}
+
+	return fmt.Errorf("fcm: unknown format %q, expected %q, %q or %q", this.Format, Format_TEXT, Format_TABLE, Format_JSON_LINES)
+}
+
+// printResults writes result to stdout as text, redacted by DefaultRedactor
+func printResults(result formattableResult) {
+	NewResultFormatter(Format_TEXT).Write(os.Stdout, result)
+}
+
+// writeText writes the fields as "Label : value" lines
+func writeText(w io.Writer, record *resultRecord) error {
+	width := 0
+	for _, field := range record.Fields {
+		if len(field.Label) > width {
+			width = len(field.Label)
+		}
+	}
+
+	var out strings.Builder
+	for _, field := range record.Fields {
+		line := fmt.Sprintf("%-*s : %v", width, field.Label, field.Value)
+		out.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+	for i, item := range record.Items {
+		fmt.Fprintf(&out, "Result(%d)>\n", i)
+		for _, field := range item {
+			line := fmt.Sprintf("\t%s : %v", field.Label, field.Value)
+			out.WriteString(strings.TrimRight(line, " ") + "\n")
+		}
+	}
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// writeTable writes the fields aligned, then the items as a table with a
+// column per field
+func writeTable(w io.Writer, record *resultRecord) error {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, field := range record.Fields {
+		fmt.Fprintf(table, "%s:\t%v\n", field.Label, field.Value)
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+	if len(record.Items) == 0 {
+		return nil
+	}
+
+	// the columns in order of appearance, items may lack some
+	var columns []string
+	seen := make(map[string]bool)
+	for _, item := range record.Items {
+		for _, field := range item {
+			if !seen[field.Label] {
+				seen[field.Label] = true
+				columns = append(columns, field.Label)
+			}
+		}
+	}
+
+	fmt.Fprintln(table)
+	fmt.Fprintf(table, "#\t%s\n", strings.ToUpper(strings.Join(columns, "\t")))
+	for i, item := range record.Items {
+		values := make(map[string]interface{}, len(item))
+		for _, field := range item {
+			values[field.Label] = field.Value
+		}
+
+		cells := make([]string, len(columns))
+		for j, column := range columns {
+			if value, ok := values[column]; ok {
+				cells[j] = fmt.Sprint(value)
+			}
+		}
+		fmt.Fprintf(table, "%d\t%s\n", i, strings.Join(cells, "\t"))
+	}
+
+	return table.Flush()
+}
+
+// writeJSONLine writes the record as a single line JSON object
+func writeJSONLine(w io.Writer, record *resultRecord) error {
+	object := map[string]interface{}{"type": record.Type}
+	for _, field := range record.Fields {
+		object[field.Key] = field.Value
+	}
+	if record.Items != nil {
+		items := make([]map[string]interface{}, 0, len(record.Items))
+		for _, item := range record.Items {
+			values := make(map[string]interface{}, len(item))
+			for _, field := range item {
+				values[field.Key] = field.Value
+			}
+			items = append(items, values)
+		}
+		object["results"] = items
+	}
+
+	line, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(line, '\n'))
+	return err
+}
+
+// mapItems the items of per-token result maps, in key order, with the
+// values of tokenKeys redacted as tokens
+func mapItems(results []map[string]string, redactor *Redactor, tokenKeys ...string) [][]resultField {
+	isToken := make(map[string]bool, len(tokenKeys))
+	for _, key := range tokenKeys {
+		isToken[key] = true
+	}
+
+	items := make([][]resultField, 0, len(results))
+	for _, result := range results {
+		keys := make([]string, 0, len(result))
+		for key := range result {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		item := make([]resultField, 0, len(keys))
+		for _, key := range keys {
+			value := redactor.String(result[key])
+			if isToken[key] {
+				value = redactor.Token(result[key])
+			}
+			item = append(item, resultField{Label: key, Key: key, Value: value})
+		}
+		items = append(items, item)
+	}
+
+	return items
+}
+
+// errorString the redacted message of err, empty when nil
+func errorString(err error, redactor *Redactor, tokens ...string) string {
+	if err == nil {
+		return ""
+	}
+
+	return redactor.String(err.Error(), tokens...)
+}
+
+func (this *FcmResponseStatus) resultRecord(redactor *Redactor) *resultRecord {
+	return &resultRecord{
+		Type: "fcm_response",
+		Fields: []resultField{
+			{"Status Code", "status_code", this.StatusCode},
+			{"Success", "success", this.Success},
+			{"Fail", "failure", this.Fail},
+			{"Canonical_ids", "canonical_ids", this.Canonical_ids},
+			{"Duplicates", "duplicates", this.Duplicates},
+			{"Topic MsgId", "message_id", this.MsgId},
+			{"Topic Err", "error", redactor.String(this.Err)},
+		},
+		Items: mapItems(this.Results, redactor),
+	}
+}
+
+func (this *InstanceIdInfoResponse) resultRecord(redactor *Redactor) *resultRecord {
+	record := &resultRecord{
+		Type: "instance_id_info",
+		Fields: []resultField{
+			{"Error", "error", redactor.String(this.Error)},
+			{"App", "application", this.Application},
+			{"Auth", "authorized_entity", this.AuthorizedEntity},
+			{"Ver", "application_version", this.ApplicationVersion},
+			{"Sig", "app_signer", this.AppSigner},
+			{"Att", "attest_status", this.AttestStatus},
+			{"Platform", "platform", this.Platform},
+			{"Connection", "connection_type", this.ConnectionType},
+			{"ConnDate", "connect_date", this.ConnectDate},
+		},
+	}
+
+	relations := make([]string, 0, len(this.Rel))
+	for relation := range this.Rel {
+		relations = append(relations, relation)
+	}
+	sort.Strings(relations)
+	for _, relation := range relations {
+		names := make([]string, 0, len(this.Rel[relation]))
+		for name := range this.Rel[relation] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			record.Items = append(record.Items, []resultField{
+				{"Rel", "relation", relation},
+				{"Name", "name", name},
+				{"addDate", "add_date", this.Rel[relation][name]["addDate"]},
+			})
+		}
+	}
+
+	return record
+}
+
+func (this *SubscribeResponse) resultRecord(redactor *Redactor) *resultRecord {
+	return &resultRecord{
+		Type: "subscribe_response",
+		Fields: []resultField{
+			{"Response Status", "status", this.Status},
+			{"Response Code", "status_code", this.StatusCode},
+			{"Error", "error", redactor.String(this.Error)},
+		},
+	}
+}
+
+func (this *BatchResponse) resultRecord(redactor *Redactor) *resultRecord {
+	return &resultRecord{
+		Type: "batch_response",
+		Fields: []resultField{
+			{"Error", "error", redactor.String(this.Error)},
+			{"Status", "status", this.Status},
+			{"Status Code", "status_code", this.StatusCode},
+		},
+		Items: mapItems(this.Results, redactor),
+	}
+}
+
+func (this *ApnsBatchResponse) resultRecord(redactor *Redactor) *resultRecord {
+	return &resultRecord{
+		Type: "apns_batch_response",
+		Fields: []resultField{
+			{"Status", "status", this.Status},
+			{"StatusCode", "status_code", this.StatusCode},
+			{"Error", "error", redactor.String(this.Error)},
+		},
+		Items: mapItems(this.Results, redactor, apns_token_key, reg_token_key),
+	}
+}
+
+func (this *SendEachResult) resultRecord(redactor *Redactor) *resultRecord {
+	record := &resultRecord{
+		Type: "send_each_result",
+		Fields: []resultField{
+			{"Success", "success", this.Success},
+			{"Fail", "failure", this.Fail},
+			{"Duplicates", "duplicates", this.Duplicates},
+		},
+	}
+
+	ids := make([]string, 0, len(this.Results))
+	for id := range this.Results {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		result := this.Results[id]
+		record.Items = append(record.Items, []resultField{
+			{"Recipient", "recipient_id", result.RecipientID},
+			{"Token", "token", redactor.Token(result.Token)},
+			{"Message ID", "message_id", result.MessageID},
+			{"Duplicate", "duplicate", result.Duplicate},
+			{"Error", "error", errorString(result.Err, redactor, result.Token)},
+		})
+	}
+
+	return record
+}
+
+func (this *TopicsSendResult) resultRecord(redactor *Redactor) *resultRecord {
+	record := &resultRecord{
+		Type: "topics_send_result",
+		Fields: []resultField{
+			{"Collapse Key", "collapse_key", this.CollapseKey},
+			{"Success", "success", this.Success},
+			{"Fail", "failure", this.Fail},
+		},
+	}
+
+	for _, group := range this.Groups {
+		record.Items = append(record.Items, []resultField{
+			{"Condition", "condition", group.Condition},
+			{"Message ID", "message_id", group.MessageID},
+			{"Error", "error", errorString(group.Err, redactor)},
+		})
+	}
+
+	return record
+}
+
+func (this *TemplateSendResult) resultRecord(redactor *Redactor) *resultRecord {
+	record := &resultRecord{
+		Type: "template_send_result",
+		Fields: []resultField{
+			{"Success", "success", this.Success},
+			{"Fail", "failure", this.Fail},
+			{"Render Errors", "render_errors", len(this.RenderErrors)},
+		},
+	}
+
+	for _, group := range this.Groups {
+		item := []resultField{
+			{"Tokens", "tokens", len(group.Tokens)},
+		}
+		if group.Rendered != nil {
+			item = append(item, resultField{"Title", "title", group.Rendered.Title})
+		}
+		if group.Status != nil {
+			item = append(item,
+				resultField{"Success", "success", group.Status.Success},
+				resultField{"Fail", "failure", group.Status.Fail})
+		}
+		item = append(item, resultField{"Error", "error", errorString(group.Err, redactor, group.Tokens...)})
+		record.Items = append(record.Items, item)
+	}
+
+	return record
+}
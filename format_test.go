@@ -0,0 +1,140 @@
+package fcm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func sendEachResultFixture() *SendEachResult {
+	return &SendEachResult{
+		Results: map[string]*RecipientResult{
+			"user-2": {RecipientID: "user-2", Token: testFcmToken, Err: errors.New("unregistered " + testFcmToken)},
+			"user-1": {RecipientID: "user-1", Token: "token1", MessageID: "projects/p/messages/1"},
+		},
+		Success: 1,
+		Fail:    1,
+	}
+}
+
+func TestResultFormatter_Text(t *testing.T) {
+	var out bytes.Buffer
+	response := &FcmResponseStatus{
+		StatusCode: 200,
+		Success:    1,
+		Results:    []map[string]string{{"messageID": "1", "success": "true"}},
+	}
+	require.Nil(t, NewResultFormatter(Format_TEXT).Write(&out, response))
+
+	require.Equal(t, `Status Code   : 200
+Success       : 1
+Fail          : 0
+Canonical_ids : 0
+Duplicates    : 0
+Topic MsgId   : 0
+Topic Err     :
+Result(0)>
+	messageID : 1
+	success : true
+`, out.String())
+}
+
+func TestResultFormatter_Table(t *testing.T) {
+	var out bytes.Buffer
+	require.Nil(t, NewResultFormatter(Format_TABLE).Write(&out, sendEachResultFixture()))
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	require.Equal(t, []string{
+		"Success:     1",
+		"Fail:        1",
+		"Duplicates:  0",
+		"",
+		"#  RECIPIENT  TOKEN                MESSAGE ID             DUPLICATE  ERROR",
+		"0  user-1     " + DefaultRedactor.Token("token1") + "  projects/p/messages/1  false      ",
+		"1  user-2     " + DefaultRedactor.Token(testFcmToken) + "                         false      unregistered " + DefaultRedactor.Token(testFcmToken),
+	}, lines)
+}
+
+func TestResultFormatter_JSONLines(t *testing.T) {
+	var out bytes.Buffer
+	formatter := NewResultFormatter(Format_JSON_LINES)
+	require.Nil(t, formatter.Write(&out, sendEachResultFixture()))
+	require.Nil(t, formatter.Write(&out, &SubscribeResponse{Status: "200 OK", StatusCode: 200}))
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+
+	var sendEach struct {
+		Type    string
+		Success int
+		Results []map[string]interface{}
+	}
+	require.Nil(t, json.Unmarshal([]byte(lines[0]), &sendEach))
+	require.Equal(t, "send_each_result", sendEach.Type)
+	require.Equal(t, 1, sendEach.Success)
+	require.Len(t, sendEach.Results, 2)
+	require.Equal(t, "user-2", sendEach.Results[1]["recipient_id"])
+	require.Equal(t, DefaultRedactor.Token(testFcmToken), sendEach.Results[1]["token"])
+
+	require.JSONEq(t, `{"type":"subscribe_response","status":"200 OK","status_code":200,"error":""}`, lines[1])
+}
+
+func TestResultFormatter_Redaction(t *testing.T) {
+	results := []interface{}{
+		sendEachResultFixture(),
+		&FcmResponseStatus{Err: "invalid " + testFcmToken, Results: []map[string]string{{"error": "NotRegistered " + testFcmToken}}},
+		&ApnsBatchResponse{Results: []map[string]string{{apns_token_key: "apns-token-0123456789", status_key: "OK", reg_token_key: testFcmToken}}},
+		&BatchResponse{Error: "bad key=" + testApiKey},
+		&TopicsSendResult{Groups: []*TopicGroupResult{{Condition: "'news' in topics", Err: errors.New("quota " + testFcmToken)}}},
+		&TemplateSendResult{Groups: []*TemplateGroupResult{{Tokens: []string{"token1"}, Err: errors.New("failed token1")}}},
+	}
+
+	for _, format := range []Format{Format_TEXT, Format_TABLE, Format_JSON_LINES} {
+		for _, result := range results {
+			var out bytes.Buffer
+			require.Nil(t, NewResultFormatter(format).Write(&out, result))
+			require.NotContains(t, out.String(), testFcmToken, "%s %T", format, result)
+			require.NotContains(t, out.String(), testApiKey, "%s %T", format, result)
+			require.NotContains(t, out.String(), "apns-token-0123456789", "%s %T", format, result)
+			require.NotContains(t, out.String(), "token1", "%s %T", format, result)
+		}
+	}
+
+	var out bytes.Buffer
+	formatter := &ResultFormatter{Format: Format_TEXT, Redactor: NewRedactor(RedactionMode_NONE)}
+	require.Nil(t, formatter.Write(&out, sendEachResultFixture()))
+	require.Contains(t, out.String(), testFcmToken)
+}
+
+func TestResultFormatter_InstanceIdInfo(t *testing.T) {
+	var out bytes.Buffer
+	info := &InstanceIdInfoResponse{
+		Application: "com.fishbrain",
+		Rel: map[string]map[string]map[string]string{
+			"topics": {"news": {"addDate": "2019-01-01"}, "alerts": {"addDate": "2019-02-01"}},
+		},
+	}
+	require.Nil(t, NewResultFormatter(Format_JSON_LINES).Write(&out, info))
+
+	var decoded struct {
+		Application string
+		Results     []map[string]string
+	}
+	require.Nil(t, json.Unmarshal(out.Bytes(), &decoded))
+	require.Equal(t, "com.fishbrain", decoded.Application)
+	require.Equal(t, []map[string]string{
+		{"relation": "topics", "name": "alerts", "add_date": "2019-02-01"},
+		{"relation": "topics", "name": "news", "add_date": "2019-01-01"},
+	}, decoded.Results)
+}
+
+func TestResultFormatter_Errors(t *testing.T) {
+	var out bytes.Buffer
+	require.EqualError(t, NewResultFormatter(Format_TEXT).Write(&out, "results"), "fcm: can't format results of type string")
+	require.EqualError(t, NewResultFormatter("xml").Write(&out, &SubscribeResponse{}), `fcm: unknown format "xml", expected "text", "table" or "jsonl"`)
+	require.Empty(t, out.String())
+}
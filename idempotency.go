@@ -0,0 +1,281 @@
+package fcm
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+
+	messaging "firebase.google.com/go/v4/messaging"
+)
+
+const (
+	// default_idempotency_window how long completed sends are remembered
+	default_idempotency_window = 24 * time.Hour
+	// default_idempotency_lease how long a send in flight holds its key, so
+	// the retry of a send interrupted by a crash isn't skipped for long
+	default_idempotency_lease = 5 * time.Minute
+	// default_idempotency_capacity keys kept by the in-memory store
+	default_idempotency_capacity = 100000
+)
+
+// IdempotencyStore remembers sends by idempotency key. A send reserves its
+// key before it starts, then marks it completed on success or releases it
+// on failure, so concurrent sends with the same key go out once
+type IdempotencyStore interface {
+	// Reserve atomically reserves key for ttl, false when it is already
+	// reserved or completed
+	Reserve(key string, ttl time.Duration) (bool, error)
+	// Release drops the reservation of key, a completed key is kept
+	Release(key string) error
+	// MarkCompleted remembers key as completed for ttl
+	MarkCompleted(key string, ttl time.Duration) error
+}
+
+// memoryIdempotencyEntry a key of the MemoryIdempotencyStore
+type memoryIdempotencyEntry struct {
+	key       string
+	expires   time.Time
+	completed bool
+}
+
+// MemoryIdempotencyStore an in-memory IdempotencyStore keeping at most
+// capacity keys, evicting the least recently used ones first
+type MemoryIdempotencyStore struct {
+	mu       sync.Mutex
+	capacity int
+	keys     map[string]*list.Element
+	order    *list.List
+	clock    Clock
+}
+
+// NewMemoryIdempotencyStore creates an in-memory store keeping at
+// most capacity keys, a default capacity is used when <= 0
+func NewMemoryIdempotencyStore(capacity int) *MemoryIdempotencyStore {
+	if capacity <= 0 {
+		capacity = default_idempotency_capacity
+	}
+
+	return &MemoryIdempotencyStore{
+		capacity: capacity,
+		keys:     make(map[string]*list.Element),
+		order:    list.New(),
+		clock:    systemClock{},
+	}
+}
+
+// Reserve atomically reserves key for ttl, false when it is already
+// reserved or completed
+func (this *MemoryIdempotencyStore) Reserve(key string, ttl time.Duration) (bool, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.get(key) != nil {
+		return false, nil
+	}
+	this.put(key, ttl, false)
+
+	return true, nil
+}
+
+// Release drops the reservation of key, a completed key is kept
+func (this *MemoryIdempotencyStore) Release(key string) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if element, ok := this.keys[key]; ok && !element.Value.(*memoryIdempotencyEntry).completed {
+		this.order.Remove(element)
+		delete(this.keys, key)
+	}
+
+	return nil
+}
+
+// MarkCompleted remembers key as completed for ttl
+func (this *MemoryIdempotencyStore) MarkCompleted(key string, ttl time.Duration) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.put(key, ttl, true)
+
+	return nil
+}
+
+// get the entry of key when it has not expired, marking it recently used.
+// Must be called with mu held
+func (this *MemoryIdempotencyStore) get(key string) *memoryIdempotencyEntry {
+	element, ok := this.keys[key]
+	if !ok {
+		return nil
+	}
+
+	entry := element.Value.(*memoryIdempotencyEntry)
+	if !this.clock.Now().Before(entry.expires) {
+		this.order.Remove(element)
+		delete(this.keys, key)
+		return nil
+	}
+
+	this.order.MoveToFront(element)
+
+	return entry
+}
+
+// put stores key for ttl, evicting the least recently used keys over
+// capacity. Must be called with mu held
+func (this *MemoryIdempotencyStore) put(key string, ttl time.Duration, completed bool) {
+	expires := this.clock.Now().Add(ttl)
+
+	if element, ok := this.keys[key]; ok {
+		entry := element.Value.(*memoryIdempotencyEntry)
+		entry.expires = expires
+		entry.completed = completed
+		this.order.MoveToFront(element)
+		return
+	}
+
+	this.keys[key] = this.order.PushFront(&memoryIdempotencyEntry{key: key, expires: expires, completed: completed})
+
+	for this.order.Len() > this.capacity {
+		oldest := this.order.Back()
+		this.order.Remove(oldest)
+		delete(this.keys, oldest.Value.(*memoryIdempotencyEntry).key)
+	}
+}
+
+// SetIdempotencyStore enables skipping sends already completed within
+// window, for messages with an idempotency key. A default window is used when <= 0
+func (this *FcmClient) SetIdempotencyStore(store IdempotencyStore, window time.Duration) *FcmClient {
+	if window <= 0 {
+		window = default_idempotency_window
+	}
+	this.Idempotency = store
+	this.IdempotencyWindow = window
+
+	return this
+}
+
+// SetIdempotencyKey sets the message idempotency key, the send to each
+// token is skipped when it already completed or is in flight with the same
+// key. Only registration_ids targets support idempotency keys
+func (this *FcmClient) SetIdempotencyKey(key string) *FcmClient {
+	this.Message.IdempotencyKey = key
+
+	return this
+}
+
+// SetTokenIdempotencyKey sets the idempotency key of the send to a
+// single token, overriding the one derived from the message key
+func (this *FcmClient) SetTokenIdempotencyKey(token string, key string) *FcmClient {
+	if this.Message.TokenIdempotencyKeys == nil {
+		this.Message.TokenIdempotencyKeys = make(map[string]string)
+	}
+	this.Message.TokenIdempotencyKeys[token] = key
+
+	return this
+}
+
+// idempotencyKey the key of the send to token, empty when it has none
+func (this *FcmMsg) idempotencyKey(token string) string {
+	if key, ok := this.TokenIdempotencyKeys[token]; ok && key != "" {
+		return key
+	}
+	if this.IdempotencyKey == "" {
+		return ""
+	}
+
+	return this.IdempotencyKey + "/" + token
+}
+
+// idempotencyTargetError the error of an idempotency key set on a topic or
+// condition send, whose keys are only applied per registration token
+func (this *FcmMsg) idempotencyTargetError() error {
+	if this.IdempotencyKey == "" || len(this.RegistrationIds) > 0 {
+		return nil
+	}
+	if this.To == "" && this.Condition == "" {
+		return nil
+	}
+
+	return errors.New("fcm: idempotency keys only apply to registration_ids targets")
+}
+
+// idempotencyWindow the window of the client, the default one when not set
+func (this *FcmClient) idempotencyWindow() time.Duration {
+	if this.IdempotencyWindow <= 0 {
+		return default_idempotency_window
+	}
+
+	return this.IdempotencyWindow
+}
+
+// idempotencyLease how long a send in flight holds its key, at most the
+// window of the client
+func (this *FcmClient) idempotencyLease() time.Duration {
+	if window := this.idempotencyWindow(); window < default_idempotency_lease {
+		return window
+	}
+
+	return default_idempotency_lease
+}
+
+// skipDuplicates reserves the keys of the tokens for a short lease, returning the tokens to
+// send and the number of tokens skipped because their send already
+// completed or is in flight. The reservations are completed or released
+// by completeSends
+func (this *FcmClient) skipDuplicates(tokens []string) ([]string, int, error) {
+	if this.Idempotency == nil {
+		return tokens, 0, nil
+	}
+
+	fresh := make([]string, 0, len(tokens))
+	duplicates := 0
+	for _, token := range tokens {
+		key := this.Message.idempotencyKey(token)
+		if key == "" {
+			fresh = append(fresh, token)
+			continue
+		}
+
+		reserved, err := this.Idempotency.Reserve(key, this.idempotencyLease())
+		if err != nil {
+			this.completeSends(fresh, nil)
+			return nil, 0, err
+		}
+		if !reserved {
+			duplicates++
+			continue
+		}
+		fresh = append(fresh, token)
+	}
+
+	return fresh, duplicates, nil
+}
+
+// completeSends marks the keys of the successful sends of the batch
+// completed and releases the others, all of them when resp is nil
+func (this *FcmClient) completeSends(tokens []string, resp *messaging.BatchResponse) error {
+	if this.Idempotency == nil {
+		return nil
+	}
+
+	var firstErr error
+	for i, token := range tokens {
+		key := this.Message.idempotencyKey(token)
+		if key == "" {
+			continue
+		}
+
+		var err error
+		if resp != nil && i < len(resp.Responses) && resp.Responses[i].Success {
+			err = this.Idempotency.MarkCompleted(key, this.idempotencyWindow())
+		} else {
+			err = this.Idempotency.Release(key)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
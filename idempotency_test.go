@@ -0,0 +1,223 @@
+package fcm
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	messaging "firebase.google.com/go/v4/messaging"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryIdempotencyStore_ExpiresAndEvicts(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)}
+	store := NewMemoryIdempotencyStore(2)
+	store.clock = clock
+
+	require.Nil(t, store.MarkCompleted("a", time.Hour))
+	reserved, _ := store.Reserve("a", time.Hour)
+	require.False(t, reserved)
+
+	clock.Advance(time.Hour)
+	reserved, _ = store.Reserve("a", time.Hour)
+	require.True(t, reserved)
+
+	require.Nil(t, store.MarkCompleted("a", time.Hour))
+	require.Nil(t, store.MarkCompleted("b", time.Hour))
+	// "a" used more recently than "b"
+	store.Reserve("a", time.Hour)
+	require.Nil(t, store.MarkCompleted("c", time.Hour))
+
+	reserved, _ = store.Reserve("a", time.Hour)
+	require.False(t, reserved)
+	reserved, _ = store.Reserve("c", time.Hour)
+	require.False(t, reserved)
+	reserved, _ = store.Reserve("b", time.Hour)
+	require.True(t, reserved)
+}
+
+func TestSendOnceFirebaseAdminGo_SkipsDuplicates(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.MatchedBy(func(mm *messaging.MulticastMessage) bool {
+		return len(mm.Tokens) == 2
+	})).Return(&messaging.BatchResponse{
+		SuccessCount: 1,
+		FailureCount: 1,
+		Responses: []*messaging.SendResponse{
+			{Success: true, MessageID: "1"},
+			{Success: false, Error: errors.New("unavailable")},
+		},
+	}, nil).Once()
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.MatchedBy(func(mm *messaging.MulticastMessage) bool {
+		return len(mm.Tokens) == 1 && mm.Tokens[0] == "token1"
+	})).Return(successBatchResponse(), nil).Once()
+
+	c := NewFcmClient("key").
+		SetIdempotencyStore(NewMemoryIdempotencyStore(0), time.Hour).
+		NewFcmRegIdsMsg([]string{"token0", "token1"}, nil).
+		SetIdempotencyKey("job-42")
+
+	// first attempt: token1 fails
+	res, err := c.sendOnceFirebaseAdminGo(messagingClientMock)
+	require.Nil(t, err)
+	require.Equal(t, 0, res.Duplicates)
+
+	// replay: only token1 is sent again
+	res, err = c.sendOnceFirebaseAdminGo(messagingClientMock)
+	require.Nil(t, err)
+	require.Equal(t, 1, res.Duplicates)
+	require.Equal(t, 1, res.Success)
+
+	// everything completed: nothing is sent
+	res, err = c.sendOnceFirebaseAdminGo(messagingClientMock)
+	require.Nil(t, err)
+	require.True(t, res.Ok)
+	require.Equal(t, 2, res.Duplicates)
+
+	messagingClientMock.AssertExpectations(t)
+}
+
+func TestFcmMsg_TokenIdempotencyKey(t *testing.T) {
+	c := NewFcmClient("key").
+		SetIdempotencyKey("job-42").
+		SetTokenIdempotencyKey("token1", "custom")
+
+	require.Equal(t, "job-42/token0", c.Message.idempotencyKey("token0"))
+	require.Equal(t, "custom", c.Message.idempotencyKey("token1"))
+
+	c.Message.IdempotencyKey = ""
+	require.Equal(t, "", c.Message.idempotencyKey("token0"))
+}
+
+func TestMemoryIdempotencyStore_ReserveAndRelease(t *testing.T) {
+	store := NewMemoryIdempotencyStore(0)
+
+	reserved, err := store.Reserve("a", time.Hour)
+	require.Nil(t, err)
+	require.True(t, reserved)
+
+	// in flight: can't be reserved again
+	reserved, _ = store.Reserve("a", time.Hour)
+	require.False(t, reserved)
+
+	require.Nil(t, store.Release("a"))
+	reserved, _ = store.Reserve("a", time.Hour)
+	require.True(t, reserved)
+
+	// a completed key is kept by Release
+	require.Nil(t, store.MarkCompleted("a", time.Hour))
+	require.Nil(t, store.Release("a"))
+	reserved, _ = store.Reserve("a", time.Hour)
+	require.False(t, reserved)
+}
+
+func TestSendOnceFirebaseAdminGo_ConcurrentSendsReserve(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			close(started)
+			<-release
+		}).
+		Return(successBatchResponse(), nil).Once()
+
+	c := NewFcmClient("key").
+		SetIdempotencyStore(NewMemoryIdempotencyStore(0), time.Hour).
+		NewFcmRegIdsMsg([]string{"token0"}, nil).
+		SetIdempotencyKey("job-42")
+
+	first := make(chan *FcmResponseStatus)
+	go func() {
+		res, _ := c.sendOnceFirebaseAdminGo(messagingClientMock)
+		first <- res
+	}()
+	<-started
+
+	// the first send is in flight: the second one is skipped
+	res, err := c.sendOnceFirebaseAdminGo(messagingClientMock)
+	require.Nil(t, err)
+	require.Equal(t, 1, res.Duplicates)
+
+	close(release)
+	require.Equal(t, 1, (<-first).Success)
+	messagingClientMock.AssertExpectations(t)
+}
+
+func TestSendOnceFirebaseAdminGo_ReleasesFailedSends(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.Anything).
+		Return((*messaging.BatchResponse)(nil), errors.New("unavailable")).Once()
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.Anything).
+		Return(successBatchResponse(), nil).Once()
+
+	c := NewFcmClient("key").
+		SetIdempotencyStore(NewMemoryIdempotencyStore(0), time.Hour).
+		NewFcmRegIdsMsg([]string{"token0"}, nil).
+		SetIdempotencyKey("job-42")
+
+	_, err := c.sendOnceFirebaseAdminGo(messagingClientMock)
+	require.NotNil(t, err)
+
+	res, err := c.sendOnceFirebaseAdminGo(messagingClientMock)
+	require.Nil(t, err)
+	require.Equal(t, 0, res.Duplicates)
+	require.Equal(t, 1, res.Success)
+	messagingClientMock.AssertExpectations(t)
+}
+
+func TestSend_IdempotencyKeyRequiresTokens(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	c := NewFcmClient("key").
+		SetMessagingClient(messagingClientMock).
+		SetIdempotencyStore(NewMemoryIdempotencyStore(0), time.Hour).
+		NewFcmMsgTo("/topics/news", nil).
+		SetIdempotencyKey("job-42")
+
+	_, err := c.Send()
+	require.EqualError(t, err, "fcm: idempotency keys only apply to registration_ids targets")
+	require.Contains(t, validationFields(t, c.Validate()), "idempotency_key")
+
+	c.Message.To = ""
+	c.Message.Condition = "'news' in topics"
+	_, err = c.Send()
+	require.NotNil(t, err)
+	messagingClientMock.AssertNotCalled(t, "SendEachForMulticast", mock.Anything, mock.Anything)
+}
+
+func TestSendOnceFirebaseAdminGo_LeaseExpires(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.Anything).
+		Return(successBatchResponse(), nil).Once()
+
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)}
+	store := NewMemoryIdempotencyStore(0)
+	store.clock = clock
+	c := NewFcmClient("key").
+		SetIdempotencyStore(store, 24*time.Hour).
+		NewFcmRegIdsMsg([]string{"token0"}, nil).
+		SetIdempotencyKey("job-42")
+
+	// a send reserved its key, then the process crashed before completing it
+	tokens, _, err := c.skipDuplicates([]string{"token0"})
+	require.Nil(t, err)
+	require.Equal(t, []string{"token0"}, tokens)
+
+	res, err := c.sendOnceFirebaseAdminGo(messagingClientMock)
+	require.Nil(t, err)
+	require.Equal(t, 1, res.Duplicates)
+
+	// the retry goes out once the lease expired, well within the window
+	clock.Advance(default_idempotency_lease)
+	res, err = c.sendOnceFirebaseAdminGo(messagingClientMock)
+	require.Nil(t, err)
+	require.Equal(t, 0, res.Duplicates)
+	require.Equal(t, 1, res.Success)
+
+	// completed sends are remembered for the whole window
+	clock.Advance(time.Hour)
+	res, _ = c.sendOnceFirebaseAdminGo(messagingClientMock)
+	require.Equal(t, 1, res.Duplicates)
+	messagingClientMock.AssertExpectations(t)
+}
@@ -7,7 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"strings"
+	"net/url"
 )
 
 const (
@@ -117,8 +117,7 @@ func (this *FcmClient) GetInfo(withDetails bool, instanceIdToken string) (*Insta
 		return nil, err
 	}
 
-	client := &http.Client{}
-	response, err := client.Do(request)
+	response, err := this.doInstanceID(Operation_GET_INFO, request, instanceIdToken)
 	if err != nil {
 		return nil, err
 	}
@@ -151,25 +150,10 @@ func parseGetInfo(body []byte) (*InstanceIdInfoResponse, error) {
 
 }
 
-// PrintResults prints InstanceIdInfoResponse, for faster debugging
+// PrintResults prints InstanceIdInfoResponse, for faster debugging,
+// redacted by DefaultRedactor
 func (this *InstanceIdInfoResponse) PrintResults() {
-	fmt.Println("Error     : ", this.Error)
-	fmt.Println("App       : ", this.Application)
-	fmt.Println("Auth      : ", this.AuthorizedEntity)
-	fmt.Println("Ver       : ", this.ApplicationVersion)
-	fmt.Println("Sig       : ", this.AppSigner)
-	fmt.Println("Att       : ", this.AttestStatus)
-	fmt.Println("Platform  : ", this.Platform)
-	fmt.Println("Connection: ", this.ConnectionType)
-	fmt.Println("ConnDate  : ", this.ConnectDate)
-	fmt.Println("Rel       : ")
-	for k, v := range this.Rel {
-		fmt.Println(k, " --> ")
-		for k2, v2 := range v {
-			fmt.Println("\t", k2, "\t|")
-			fmt.Println("\t\t", "addDate", " : ", v2["addDate"])
-		}
-	}
+	printResults(this)
 }
 
 // generateGetInfoUrl generate based on with details and the instance token
@@ -180,7 +164,12 @@ func generateGetInfoUrl(srv string, instanceIdToken string) string {
 // SubscribeToTopic subscribes a single device/token to a topic
 func (this *FcmClient) SubscribeToTopic(instanceIdToken string, topic string) (*SubscribeResponse, error) {
 
-	request, err := http.NewRequest("POST", generateSubToTopicUrl(instanceIdToken, topic), nil)
+	parsedTopic, err := ParseTopic(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequest("POST", generateSubToTopicUrl(instanceIdToken, parsedTopic), nil)
 	request.Header.Set("Authorization", this.apiKeyHeader())
 	request.Header.Set("Content-Type", "application/json")
 
@@ -188,8 +177,7 @@ func (this *FcmClient) SubscribeToTopic(instanceIdToken string, topic string) (*
 		return nil, err
 	}
 
-	client := &http.Client{}
-	response, err := client.Do(request)
+	response, err := this.doInstanceID(Operation_SUBSCRIBE, request, instanceIdToken, url.PathEscape(instanceIdToken))
 	if err != nil {
 		return nil, err
 	}
@@ -223,25 +211,15 @@ func parseSubscribeResponse(body []byte, resp *http.Response) (*SubscribeRespons
 	return subResp, nil
 }
 
-// PrintResults prints SubscribeResponse, for faster debugging
+// PrintResults prints SubscribeResponse, for faster debugging,
+// redacted by DefaultRedactor
 func (this *SubscribeResponse) PrintResults() {
-
-	fmt.Println("Response Status: ", this.Status)
-	fmt.Println("Response Code  : ", this.StatusCode)
-	if this.StatusCode != 200 {
-		fmt.Println("Error          : ", this.Error)
-	}
-
+	printResults(this)
 }
 
 // generateSubToTopicUrl generates a url based on the instnace id and topic name
-func generateSubToTopicUrl(instaceId string, topic string) string {
-	Tmptopic := strings.ToLower(topic)
-	if strings.Contains(Tmptopic, "/topics/") {
-		tmp := strings.Split(topic, "/")
-		topic = tmp[len(tmp)-1]
-	}
-	return fmt.Sprintf(subscribe_instanceid_to_topic_srv_url, instaceId, topic)
+func generateSubToTopicUrl(instaceId string, topic Topic) string {
+	return fmt.Sprintf(subscribe_instanceid_to_topic_srv_url, url.PathEscape(instaceId), topic.Name())
 }
 
 // BatchSubscribeToTopic subscribes (many) devices/tokens to a given topic
@@ -253,17 +231,16 @@ func (this *FcmClient) BatchSubscribeToTopic(tokens []string, topic string) (*Ba
 	}
 
 	request, err := http.NewRequest("POST", batch_add_srv_url, bytes.NewBuffer(jsonByte))
-	request.Header.Set("Authorization", this.apiKeyHeader())
-	request.Header.Set("Content-Type", "application/json")
-
 	if err != nil {
-		fmt.Println(err)
+		return nil, err
 	}
+	request.Header.Set("Authorization", this.apiKeyHeader())
+	request.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
-	response, err := client.Do(request)
+	response, err := this.doInstanceID(Operation_BATCH_SUBSCRIBE, request, tokens...)
 	if err != nil {
-		fmt.Println(err)
+		this.logger().Error("error subscribing tokens to topic", "tokens", len(tokens), "topic", topic, "error", err)
+		return nil, err
 	}
 
 	defer response.Body.Close()
@@ -290,22 +267,20 @@ func (this *FcmClient) BatchUnsubscribeFromTopic(tokens []string, topic string)
 
 	jsonByte, err := generateBatchRequest(tokens, topic)
 	if err != nil {
-		fmt.Println(err)
 		return nil, err
 	}
 
 	request, err := http.NewRequest("POST", batch_rem_srv_url, bytes.NewBuffer(jsonByte))
-	request.Header.Set("Authorization", this.apiKeyHeader())
-	request.Header.Set("Content-Type", "application/json")
-
 	if err != nil {
-		fmt.Println(err)
+		return nil, err
 	}
+	request.Header.Set("Authorization", this.apiKeyHeader())
+	request.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
-	response, err := client.Do(request)
+	response, err := this.doInstanceID(Operation_BATCH_UNSUBSCRIBE, request, tokens...)
 	if err != nil {
-		fmt.Println(err)
+		this.logger().Error("error unsubscribing tokens from topic", "tokens", len(tokens), "topic", topic, "error", err)
+		return nil, err
 	}
 
 	defer response.Body.Close()
@@ -327,22 +302,21 @@ func (this *FcmClient) BatchUnsubscribeFromTopic(tokens []string, topic string)
 	return result, nil
 }
 
-// PrintResults prints BatchResponse, for faster debugging
+// PrintResults prints BatchResponse, for faster debugging,
+// redacted by DefaultRedactor
 func (this *BatchResponse) PrintResults() {
-	fmt.Println("Error       : ", this.Error)
-	fmt.Println("Status      : ", this.Status)
-	fmt.Println("Status Code : ", this.StatusCode)
-	for i, val := range this.Results {
-		if _, ok := batchErrors[val["error"]]; ok {
-			fmt.Println("ID: ", i, " | ", val["error"])
-		}
-	}
+	printResults(this)
 }
 
 // generateBatchRequest based on tokens and topic
 func generateBatchRequest(tokens []string, topic string) ([]byte, error) {
+	parsedTopic, err := ParseTopic(topic)
+	if err != nil {
+		return nil, err
+	}
+
 	envelope := new(BatchRequest)
-	envelope.To = topics + extractTopicName(topic)
+	envelope.To = parsedTopic.Path()
 	envelope.RegTokens = make([]string, len(tokens))
 	copy(envelope.RegTokens, tokens)
 
@@ -350,12 +324,11 @@ func generateBatchRequest(tokens []string, topic string) ([]byte, error) {
 
 }
 
-// extractTopicName extract topic name for valid topic name input
+// extractTopicName strips the /topics/ prefix (case insensitive) of a topic,
+// use ParseTopic to validate the name too
 func extractTopicName(inTopic string) (result string) {
-	Tmptopic := strings.ToLower(inTopic)
-	if strings.Contains(Tmptopic, "/topics/") {
-		tmp := strings.Split(inTopic, "/")
-		result = tmp[len(tmp)-1]
+	if isTopicTarget(inTopic) {
+		result = inTopic[len(topics):]
 		return
 	}
 
@@ -391,8 +364,7 @@ func (this *FcmClient) ApnsBatchImportRequest(apnsReq *ApnsBatchRequest) (*ApnsB
 		return nil, err
 	}
 
-	client := &http.Client{}
-	response, err := client.Do(request)
+	response, err := this.doInstanceID(Operation_APNS_BATCH_IMPORT, request)
 	if err != nil {
 		return nil, err
 	}
@@ -440,15 +412,8 @@ func parseApnsBatchResponse(resp []byte) (*ApnsBatchResponse, error) {
 
 }
 
-// PrintResults prints ApnsBatchResponse, for faster debugging
+// PrintResults prints ApnsBatchResponse, for faster debugging,
+// redacted by DefaultRedactor
 func (this *ApnsBatchResponse) PrintResults() {
-	fmt.Println("Status     : ", this.Status)
-	fmt.Println("StatusCode : ", this.StatusCode)
-	fmt.Println("Error      : ", this.Error)
-	for i, val := range this.Results {
-		fmt.Println(i, ":")
-		fmt.Println("\tAPNS Token", val[apns_token_key])
-		fmt.Println("\tStatus    ", val[status_key])
-		fmt.Println("\tReg Token  ", val[reg_token_key])
-	}
+	printResults(this)
 }
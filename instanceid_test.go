@@ -1,12 +1,24 @@
 package fcm
 
 import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
 	"testing"
 )
 
+// failingTransport a http.RoundTripper failing every request
+type failingTransport struct{}
+
+func (failingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("connection refused")
+}
+
 func TestGenTopicUrl(t *testing.T) {
 	expected := "https://iid.googleapis.com/iid/v1/DeviceToken/rel/topics/TopicNamE"
-	result := generateSubToTopicUrl("DeviceToken", "TopicNamE")
+	result := generateSubToTopicUrl("DeviceToken", Topic("TopicNamE"))
 
 	if result != expected {
 		t.Error("Gen Topic Url Error")
@@ -131,3 +143,26 @@ func TestExtractTopicName(t *testing.T) {
 		t.Error("Extracting topic name faild")
 	}
 }
+
+func TestBatchTopic_TransportError(t *testing.T) {
+	transport := http.DefaultTransport
+	http.DefaultTransport = failingTransport{}
+	defer func() { http.DefaultTransport = transport }()
+
+	var out bytes.Buffer
+	c := NewFcmClient(testApiKey).SetLogger(slog.New(slog.NewTextHandler(&out, nil)))
+
+	result, err := c.BatchSubscribeToTopic([]string{testFcmToken}, "news")
+	if err == nil || result != nil {
+		t.Error("BatchSubscribeToTopic didn't fail on a transport error")
+	}
+
+	result, err = c.BatchUnsubscribeFromTopic([]string{testFcmToken}, "news")
+	if err == nil || result != nil {
+		t.Error("BatchUnsubscribeFromTopic didn't fail on a transport error")
+	}
+
+	if !strings.Contains(out.String(), "connection refused") || strings.Contains(out.String(), testFcmToken) {
+		t.Errorf("unexpected log output: %s", out.String())
+	}
+}
@@ -0,0 +1,116 @@
+package fcm
+
+import (
+	"context"
+	"fmt"
+
+	messaging "firebase.google.com/go/v4/messaging"
+)
+
+// SendRequest a call to the messaging transport, either a multicast
+// message or a batch of messages
+type SendRequest struct {
+	// Operation Operation_MULTICAST or Operation_SEND_EACH
+	Operation string
+	// Multicast the message of Operation_MULTICAST
+	Multicast *messaging.MulticastMessage
+	// Messages the messages of Operation_SEND_EACH
+	Messages []*messaging.Message
+}
+
+// Sends the number of sends of the request, one per token or message,
+// and of SendResponses of its BatchResponse
+func (this *SendRequest) Sends() int {
+	if this.Operation == Operation_MULTICAST {
+		if this.Multicast == nil {
+			return 0
+		}
+		return len(this.Multicast.Tokens)
+	}
+
+	return len(this.Messages)
+}
+
+// SendFunc delivers a SendRequest, the http.RoundTripper of the messaging
+// transport
+type SendFunc func(ctx context.Context, request *SendRequest) (*messaging.BatchResponse, error)
+
+// Interceptor wraps the SendFunc delivering the messages of a client, like a
+// http.RoundTripper middleware. It may inspect or modify the request before
+// calling next, observe or modify the response after it, or return without
+// calling next to short-circuit the send. A short-circuiting interceptor
+// returns an error, or a response with a SendResponse per send of the
+// request, the messages may be modified but none added or removed
+type Interceptor func(next SendFunc) SendFunc
+
+// ChainInterceptors composes interceptors into one, the first being the
+// outermost: it sees the request first and the response last
+func ChainInterceptors(interceptors ...Interceptor) Interceptor {
+	return func(next SendFunc) SendFunc {
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			next = interceptors[i](next)
+		}
+
+		return next
+	}
+}
+
+// SetInterceptors sets the interceptors wrapping every send of the client,
+// the first being the outermost. They run within the span of the send and
+// outside the Metrics, which only count the sends reaching the transport
+func (this *FcmClient) SetInterceptors(interceptors ...Interceptor) *FcmClient {
+	this.Interceptors = interceptors
+
+	return this
+}
+
+// interceptedClient a MessagingClient sending through an interceptor chain
+type interceptedClient struct {
+	send SendFunc
+}
+
+// intercept wraps client in the interceptors of the client, if any
+func (this *FcmClient) intercept(client MessagingClient) MessagingClient {
+	if len(this.Interceptors) == 0 {
+		return client
+	}
+
+	transport := func(ctx context.Context, request *SendRequest) (*messaging.BatchResponse, error) {
+		switch request.Operation {
+		case Operation_MULTICAST:
+			return client.SendEachForMulticast(ctx, request.Multicast)
+		case Operation_SEND_EACH:
+			return sendEachWith(ctx, client, request.Messages)
+		}
+
+		return nil, fmt.Errorf("fcm: unknown send operation %q", request.Operation)
+	}
+
+	return &interceptedClient{send: ChainInterceptors(this.Interceptors...)(transport)}
+}
+
+func (this *interceptedClient) SendEachForMulticast(ctx context.Context, message *messaging.MulticastMessage) (*messaging.BatchResponse, error) {
+	return this.do(ctx, &SendRequest{Operation: Operation_MULTICAST, Multicast: message}, len(message.Tokens))
+}
+
+func (this *interceptedClient) SendEach(ctx context.Context, messages []*messaging.Message) (*messaging.BatchResponse, error) {
+	return this.do(ctx, &SendRequest{Operation: Operation_SEND_EACH, Messages: messages}, len(messages))
+}
+
+// do sends request through the chain, checking the response still has a
+// SendResponse per send
+func (this *interceptedClient) do(ctx context.Context, request *SendRequest, sends int) (*messaging.BatchResponse, error) {
+	response, err := this.send(ctx, request)
+	if err != nil {
+		return response, err
+	}
+	if response == nil || len(response.Responses) != sends {
+		responses := 0
+		if response != nil {
+			responses = len(response.Responses)
+		}
+		return nil, fmt.Errorf("fcm: interceptors returned %d responses for %d sends", responses, sends)
+	}
+
+	return response, nil
+}
@@ -0,0 +1,167 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	messaging "firebase.google.com/go/v4/messaging"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingInterceptor appends name to calls before and after the send
+func recordingInterceptor(name string, calls *[]string) Interceptor {
+	return func(next SendFunc) SendFunc {
+		return func(ctx context.Context, request *SendRequest) (*messaging.BatchResponse, error) {
+			*calls = append(*calls, name+" before")
+			response, err := next(ctx, request)
+			*calls = append(*calls, name+" after")
+			return response, err
+		}
+	}
+}
+
+func TestInterceptors_Order(t *testing.T) {
+	var calls []string
+	transport := func(ctx context.Context, request *SendRequest) (*messaging.BatchResponse, error) {
+		calls = append(calls, "transport")
+		return successBatchResponse(), nil
+	}
+
+	chain := ChainInterceptors(
+		recordingInterceptor("a", &calls),
+		ChainInterceptors(recordingInterceptor("b", &calls), recordingInterceptor("c", &calls)),
+	)
+	_, err := chain(transport)(context.Background(), &SendRequest{Operation: Operation_MULTICAST})
+	require.Nil(t, err)
+	require.Equal(t, []string{"a before", "b before", "c before", "transport", "c after", "b after", "a after"}, calls)
+
+	calls = nil
+	_, err = ChainInterceptors()(transport)(context.Background(), &SendRequest{})
+	require.Nil(t, err)
+	require.Equal(t, []string{"transport"}, calls)
+}
+
+func TestInterceptors_ModifyAndObserve(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.MatchedBy(func(message *messaging.MulticastMessage) bool {
+		return message.Data["tenant"] == "fishbrain"
+	})).Return(successBatchResponse(), nil).Once()
+
+	tenant := func(next SendFunc) SendFunc {
+		return func(ctx context.Context, request *SendRequest) (*messaging.BatchResponse, error) {
+			request.Multicast.Data = map[string]string{"tenant": "fishbrain"}
+			return next(ctx, request)
+		}
+	}
+	var observed *messaging.BatchResponse
+	audit := func(next SendFunc) SendFunc {
+		return func(ctx context.Context, request *SendRequest) (*messaging.BatchResponse, error) {
+			response, err := next(ctx, request)
+			observed = response
+			return response, err
+		}
+	}
+
+	c := NewFcmClient("key").
+		SetMessagingClient(messagingClientMock).
+		SetInterceptors(audit, tenant).
+		NewFcmRegIdsMsg([]string{"token0"}, nil)
+
+	status, err := c.Send()
+	require.Nil(t, err)
+	require.Equal(t, 1, status.Success)
+	require.NotNil(t, observed)
+	require.Equal(t, "123", observed.Responses[0].MessageID)
+	messagingClientMock.AssertExpectations(t)
+}
+
+func TestInterceptors_ShortCircuit(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	metrics := newRecordingMetrics()
+
+	suppressed := errors.New("suppressed by feature flag")
+	suppress := func(next SendFunc) SendFunc {
+		return func(ctx context.Context, request *SendRequest) (*messaging.BatchResponse, error) {
+			return nil, suppressed
+		}
+	}
+
+	c := NewFcmClient("key").
+		SetMessagingClient(messagingClientMock).
+		SetMetrics(metrics).
+		SetInterceptors(suppress).
+		NewFcmRegIdsMsg([]string{"token0"}, nil)
+
+	_, err := c.Send()
+	require.True(t, errors.Is(err, suppressed))
+	require.Empty(t, metrics.messages)
+	messagingClientMock.AssertNotCalled(t, "SendEachForMulticast", mock.Anything, mock.Anything)
+
+	var calls []string
+	fake := func(next SendFunc) SendFunc {
+		return func(ctx context.Context, request *SendRequest) (*messaging.BatchResponse, error) {
+			responses := make([]*messaging.SendResponse, request.Sends())
+			for i := range responses {
+				responses[i] = &messaging.SendResponse{Success: true, MessageID: "fake"}
+			}
+			return &messaging.BatchResponse{SuccessCount: len(responses), Responses: responses}, nil
+		}
+	}
+	status, err := c.SetInterceptors(recordingInterceptor("outer", &calls), fake, recordingInterceptor("inner", &calls)).Send()
+	require.Nil(t, err)
+	require.Equal(t, 1, status.Success)
+	require.Equal(t, []string{"outer before", "outer after"}, calls)
+}
+
+func TestInterceptors_MismatchedResponse(t *testing.T) {
+	empty := func(next SendFunc) SendFunc {
+		return func(ctx context.Context, request *SendRequest) (*messaging.BatchResponse, error) {
+			return nil, nil
+		}
+	}
+
+	c := NewFcmClient("key").
+		SetMessagingClient(new(fcmMock)).
+		SetInterceptors(empty).
+		NewFcmRegIdsMsg([]string{"token0", "token1"}, nil)
+
+	_, err := c.Send()
+	require.EqualError(t, err, "fcm: interceptors returned 0 responses for 2 sends")
+}
+
+func TestInterceptors_SendEach(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEach", mock.Anything, mock.MatchedBy(func(messages []*messaging.Message) bool {
+		return len(messages) == 2 && messages[0].Data["audited"] == "true" && messages[1].Data["audited"] == "true"
+	})).Return(&messaging.BatchResponse{
+		SuccessCount: 2,
+		Responses: []*messaging.SendResponse{
+			{Success: true, MessageID: "1"},
+			{Success: true, MessageID: "2"},
+		},
+	}, nil).Once()
+
+	var operations []string
+	audit := func(next SendFunc) SendFunc {
+		return func(ctx context.Context, request *SendRequest) (*messaging.BatchResponse, error) {
+			operations = append(operations, request.Operation)
+			for _, message := range request.Messages {
+				message.Data = map[string]string{"audited": "true"}
+			}
+			return next(ctx, request)
+		}
+	}
+
+	c := NewFcmClient("key").SetMessagingClient(messagingClientMock).SetInterceptors(audit)
+	msg := FcmMsg{Notification: &NotificationPayload{Title: "title"}}
+	result, err := c.SendEach([]RecipientMessage{
+		{RecipientID: "a", Token: "token0", Message: msg},
+		{RecipientID: "b", Token: "token1", Message: msg},
+	}, SendEachOptions{})
+	require.Nil(t, err)
+	require.Equal(t, 2, result.Success)
+	require.Equal(t, []string{Operation_SEND_EACH}, operations)
+	messagingClientMock.AssertExpectations(t)
+}
@@ -0,0 +1,236 @@
+package fcm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Catalog translated messages by locale and message key
+type Catalog interface {
+	// Lookup the message of key for exactly the locale, no fallbacks
+	Lookup(locale string, key string) (string, bool)
+}
+
+// MemoryCatalog an in-memory Catalog, messages by locale then key
+type MemoryCatalog map[string]map[string]string
+
+// Lookup the message of key for the locale
+func (this MemoryCatalog) Lookup(locale string, key string) (string, bool) {
+	message, ok := this[normaliseLocale(locale)][key]
+
+	return message, ok
+}
+
+// Add the messages of a locale, replacing existing keys
+func (this MemoryCatalog) Add(locale string, messages map[string]string) {
+	locale = normaliseLocale(locale)
+	if this[locale] == nil {
+		this[locale] = make(map[string]string)
+	}
+	for key, message := range messages {
+		this[locale][key] = message
+	}
+}
+
+// LoadCatalogDir loads a catalog from the JSON files of dir, one file
+// per locale named after it (e.g. "sv-SE.json"), mapping keys to messages
+func LoadCatalogDir(dir string) (MemoryCatalog, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	catalog := make(MemoryCatalog)
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var messages map[string]string
+		if err := json.Unmarshal(content, &messages); err != nil {
+			return nil, fmt.Errorf("fcm: loading catalog %s: %w", path, err)
+		}
+
+		catalog.Add(strings.TrimSuffix(filepath.Base(path), ".json"), messages)
+	}
+
+	return catalog, nil
+}
+
+// Localizer translates notification loc keys on the server, so new copy
+// doesn't need an app release. Messages may reference the loc args as
+// {0}, {1}, ...
+type Localizer struct {
+	Catalog Catalog
+	// DefaultLocale of recipients without a locale, and the last fallback
+	DefaultLocale string
+}
+
+// NewLocalizer creates a localizer falling back to defaultLocale
+func NewLocalizer(catalog Catalog, defaultLocale string) *Localizer {
+	return &Localizer{
+		Catalog:       catalog,
+		DefaultLocale: defaultLocale,
+	}
+}
+
+// Fallbacks the locales tried for a recipient locale, most specific
+// first, e.g. sv-SE → sv → en
+func (this *Localizer) Fallbacks(locale string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	add := func(locale string) {
+		for locale != "" {
+			if !seen[locale] {
+				seen[locale] = true
+				result = append(result, locale)
+			}
+
+			i := strings.LastIndex(locale, "-")
+			if i < 0 {
+				break
+			}
+			locale = locale[:i]
+		}
+	}
+
+	add(normaliseLocale(locale))
+	add(normaliseLocale(this.DefaultLocale))
+
+	return result
+}
+
+// Localize returns a copy of the notification with its title and body loc
+// keys translated for the locale, and the locales the title and body were
+// resolved in. Keys missing from every fallback locale are kept, to be
+// localised by the app.
+func (this *Localizer) Localize(notification *NotificationPayload, locale string) (*NotificationPayload, string) {
+	localized := *notification
+	fallbacks := this.Fallbacks(locale)
+
+	titleLocale := ""
+	if message, resolved, ok := this.lookup(fallbacks, notification.TitleLocKey); ok {
+		localized.Title = formatLocArgs(message, notification.TitleLocArgs)
+		localized.TitleLocKey = ""
+		localized.TitleLocArgs = nil
+		titleLocale = resolved
+	}
+
+	bodyLocale := ""
+	if message, resolved, ok := this.lookup(fallbacks, notification.BodyLocKey); ok {
+		localized.Body = formatLocArgs(message, notification.BodyLocArgs)
+		localized.BodyLocKey = ""
+		localized.BodyLocArgs = nil
+		bodyLocale = resolved
+	}
+
+	if titleLocale == bodyLocale || bodyLocale == "" {
+		return &localized, titleLocale
+	}
+	if titleLocale == "" {
+		return &localized, bodyLocale
+	}
+
+	return &localized, titleLocale + "," + bodyLocale
+}
+
+// lookup the message of key in the first fallback locale having it
+func (this *Localizer) lookup(fallbacks []string, key string) (string, string, bool) {
+	if key == "" {
+		return "", "", false
+	}
+
+	for _, locale := range fallbacks {
+		if message, ok := this.Catalog.Lookup(locale, key); ok {
+			return message, locale, true
+		}
+	}
+
+	return "", "", false
+}
+
+// normaliseLocale lower cases the locale and uses - as separator, sv_SE → sv-se
+func normaliseLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+// formatLocArgs replaces the {n} placeholders of message with args
+func formatLocArgs(message string, args []string) string {
+	if len(args) == 0 {
+		return message
+	}
+
+	replacements := make([]string, 0, 2*len(args))
+	for i, arg := range args {
+		replacements = append(replacements, "{"+strconv.Itoa(i)+"}", arg)
+	}
+
+	return strings.NewReplacer(replacements...).Replace(message)
+}
+
+// SetLocalizer localises notifications on the server for every recipient
+// locale, see SetTokenLocale. One multicast is sent per resolved locale.
+func (this *FcmClient) SetLocalizer(localizer *Localizer) *FcmClient {
+	this.Localizer = localizer
+
+	return this
+}
+
+// SetTokenLocale sets the locale (e.g. "sv-SE") of a token
+func (this *FcmClient) SetTokenLocale(token string, locale string) *FcmClient {
+	if this.Message.Locales == nil {
+		this.Message.Locales = make(map[string]string)
+	}
+	this.Message.Locales[token] = locale
+
+	return this
+}
+
+// SetTokenLocales sets the locales of many tokens
+func (this *FcmClient) SetTokenLocales(locales map[string]string) *FcmClient {
+	for token, locale := range locales {
+		this.SetTokenLocale(token, locale)
+	}
+
+	return this
+}
+
+// localeGroups groups the tokens by the locales their notification
+// resolves in, nil when the message isn't localised on the server
+func (this *FcmClient) localeGroups(tokens []string) []*multicastGroup {
+	notification := this.Message.Notification
+	if this.Localizer == nil || notification == nil ||
+		(notification.TitleLocKey == "" && notification.BodyLocKey == "") {
+		return nil
+	}
+
+	var groups []*multicastGroup
+	byResolved := make(map[string]*multicastGroup)
+	byLocale := make(map[string]*multicastGroup)
+	for i, token := range tokens {
+		locale := normaliseLocale(this.Message.Locales[token])
+
+		group, ok := byLocale[locale]
+		if !ok {
+			localized, resolved := this.Localizer.Localize(notification, locale)
+
+			group, ok = byResolved[resolved]
+			if !ok {
+				group = &multicastGroup{notification: localized}
+				byResolved[resolved] = group
+				groups = append(groups, group)
+			}
+			byLocale[locale] = group
+		}
+
+		group.indexes = append(group.indexes, i)
+		group.tokens = append(group.tokens, token)
+	}
+
+	return groups
+}
@@ -0,0 +1,152 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	messaging "firebase.google.com/go/v4/messaging"
+	"github.com/stretchr/testify/require"
+)
+
+func testCatalog() MemoryCatalog {
+	catalog := make(MemoryCatalog)
+	catalog.Add("en", map[string]string{
+		"catch_title": "New catch",
+		"catch_body":  "{0} caught a {1}",
+	})
+	catalog.Add("sv", map[string]string{
+		"catch_title": "Ny fångst",
+		"catch_body":  "{0} fångade en {1}",
+	})
+	catalog.Add("sv_SE", map[string]string{
+		"catch_title": "Ny fångst!",
+	})
+
+	return catalog
+}
+
+func TestLocalizer_Fallbacks(t *testing.T) {
+	localizer := NewLocalizer(testCatalog(), "en")
+
+	require.Equal(t, []string{"sv-se", "sv", "en"}, localizer.Fallbacks("sv_SE"))
+	require.Equal(t, []string{"zh-hant-tw", "zh-hant", "zh", "en"}, localizer.Fallbacks("zh-Hant-TW"))
+	require.Equal(t, []string{"en-gb", "en"}, localizer.Fallbacks("en-GB"))
+	require.Equal(t, []string{"en"}, localizer.Fallbacks(""))
+}
+
+func TestLocalizer_Localize(t *testing.T) {
+	localizer := NewLocalizer(testCatalog(), "en")
+	notification := &NotificationPayload{
+		TitleLocKey: "catch_title",
+		BodyLocKey:  "catch_body",
+		BodyLocArgs: []string{"Anna", "pike"},
+	}
+
+	localized, resolved := localizer.Localize(notification, "sv-SE")
+	require.Equal(t, "Ny fångst!", localized.Title)
+	require.Equal(t, "Anna fångade en pike", localized.Body)
+	require.Empty(t, localized.BodyLocKey)
+	require.Nil(t, localized.BodyLocArgs)
+	require.Equal(t, "sv-se,sv", resolved)
+	// the original is left untouched
+	require.Equal(t, "catch_body", notification.BodyLocKey)
+
+	localized, resolved = localizer.Localize(notification, "de-DE")
+	require.Equal(t, "Anna caught a pike", localized.Body)
+	require.Equal(t, "en", resolved)
+
+	// unknown keys are left for the app to localise
+	localized, resolved = localizer.Localize(&NotificationPayload{BodyLocKey: "unknown"}, "sv")
+	require.Equal(t, "unknown", localized.BodyLocKey)
+	require.Empty(t, resolved)
+}
+
+func TestLoadCatalogDir(t *testing.T) {
+	dir := t.TempDir()
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "sv-SE.json"), []byte(`{"catch_title": "Ny fångst"}`), 0o644))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "en.json"), []byte(`{"catch_title": "New catch"}`), 0o644))
+
+	catalog, err := LoadCatalogDir(dir)
+	require.Nil(t, err)
+
+	message, ok := catalog.Lookup("sv-se", "catch_title")
+	require.True(t, ok)
+	require.Equal(t, "Ny fångst", message)
+
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "de.json"), []byte(`not json`), 0o644))
+	_, err = LoadCatalogDir(dir)
+	require.NotNil(t, err)
+}
+
+// recordingMessagingClient answers every multicast send, failing token3
+type recordingMessagingClient struct {
+	fcmMock
+	sent map[string][]string
+}
+
+func (this *recordingMessagingClient) SendEachForMulticast(_ context.Context, message *messaging.MulticastMessage) (*messaging.BatchResponse, error) {
+	this.sent[message.Notification.Title] = message.Tokens
+
+	response := &messaging.BatchResponse{}
+	for _, token := range message.Tokens {
+		if token == "token3" {
+			response.Responses = append(response.Responses, &messaging.SendResponse{Error: errors.New("unregistered")})
+			response.FailureCount++
+		} else {
+			response.Responses = append(response.Responses, &messaging.SendResponse{Success: true, MessageID: token})
+			response.SuccessCount++
+		}
+	}
+
+	return response, nil
+}
+
+func TestSend_GroupsByLocale(t *testing.T) {
+	messagingClient := &recordingMessagingClient{sent: make(map[string][]string)}
+
+	c := NewFcmClient("key").
+		SetMessagingClient(messagingClient).
+		SetLocalizer(NewLocalizer(testCatalog(), "en")).
+		NewFcmRegIdsMsg([]string{"token0", "token1", "token2", "token3"}, nil).
+		SetNotificationPayload(&NotificationPayload{TitleLocKey: "catch_title"}).
+		SetTokenLocales(map[string]string{
+			"token0": "sv-SE",
+			"token1": "en-US",
+			"token2": "sv_se",
+		})
+
+	status, err := c.Send()
+	require.Nil(t, err)
+	require.Equal(t, map[string][]string{
+		"Ny fångst!": {"token0", "token2"},
+		"New catch":  {"token1", "token3"},
+	}, messagingClient.sent)
+
+	require.Equal(t, 3, status.Success)
+	require.Equal(t, 1, status.Fail)
+	// results follow the order of the message tokens
+	require.Equal(t, "token0", status.Results[0]["messageID"])
+	require.Equal(t, "token1", status.Results[1]["messageID"])
+	require.Equal(t, "token2", status.Results[2]["messageID"])
+	require.Equal(t, "unregistered", status.Results[3]["error"])
+}
+
+func TestMakeMulticastMessage_LocKeys(t *testing.T) {
+	msg := FcmMsg{
+		RegistrationIds: []string{"token0"},
+		Notification: &NotificationPayload{
+			BodyLocKey:  "catch_body",
+			BodyLocArgs: []string{"Anna", "pike"},
+		},
+	}
+
+	message, err := msg.makeMulticastMessage()
+	require.Nil(t, err)
+	require.Equal(t, "catch_body", message.APNS.Payload.Aps.Alert.LocKey)
+	require.Equal(t, []string{"Anna", "pike"}, message.APNS.Payload.Aps.Alert.LocArgs)
+	require.Equal(t, "catch_body", message.Android.Notification.BodyLocKey)
+	require.Equal(t, []string{"Anna", "pike"}, message.Android.Notification.BodyLocArgs)
+}
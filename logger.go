@@ -0,0 +1,25 @@
+package fcm
+
+import (
+	"log/slog"
+
+	"github.com/fishbrain/go-fcm/utils"
+)
+
+// SetLogger sets the logger of the client, which logs nothing without one.
+// Tokens and credentials are redacted from the records, see SetRedactor
+func (this *FcmClient) SetLogger(logger *slog.Logger) *FcmClient {
+	this.Logger = logger
+
+	return this
+}
+
+// logger the redacting logger of the client, dropping every record when
+// none is set
+func (this *FcmClient) logger() *slog.Logger {
+	if this.Logger == nil {
+		return slog.New(utils.DiscardHandler)
+	}
+
+	return slog.New(&redactingHandler{handler: this.Logger.Handler(), redactor: this.redactor()})
+}
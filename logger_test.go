@@ -0,0 +1,42 @@
+package fcm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	messaging "firebase.google.com/go/v4/messaging"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogger_DefaultDiscards(t *testing.T) {
+	c := NewFcmClient("key")
+	require.False(t, c.logger().Enabled(context.Background(), slog.LevelError))
+}
+
+func TestLogger_StructuredRecords(t *testing.T) {
+	authorize := authAndGetFcmClient
+	defer func() { authAndGetFcmClient = authorize }()
+	authAndGetFcmClient = func(*slog.Logger) (*messaging.Client, error) {
+		return nil, errors.New("no credentials")
+	}
+
+	var out bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	c := NewFcmClient("key").SetLogger(logger).NewFcmRegIdsMsg([]string{"token0"}, nil)
+	_, err := c.Send()
+	require.NotNil(t, err)
+	require.Contains(t, out.String(), `level=ERROR msg="error getting messaging client" credentials=key error="no credentials"`)
+
+	out.Reset()
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.Anything).Return(successBatchResponse(), nil).Once()
+	_, err = c.SetMessagingClient(messagingClientMock).Send()
+	require.Nil(t, err)
+	require.Contains(t, out.String(), `level=DEBUG msg="sent message" success=1 failure=0 duplicates=0`)
+	require.NotContains(t, out.String(), "token0")
+}
@@ -0,0 +1,207 @@
+package fcm
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	messaging "firebase.google.com/go/v4/messaging"
+)
+
+// ErrorCode the kind of a failed send, one per FCM error
+type ErrorCode string
+
+const (
+	// ErrorCode_UNREGISTERED the token is no longer registered, remove it
+	ErrorCode_UNREGISTERED ErrorCode = "unregistered"
+	// ErrorCode_INVALID_ARGUMENT the message or the token is malformed
+	ErrorCode_INVALID_ARGUMENT ErrorCode = "invalid-argument"
+	// ErrorCode_SENDER_ID_MISMATCH the token belongs to another sender
+	ErrorCode_SENDER_ID_MISMATCH ErrorCode = "sender-id-mismatch"
+	// ErrorCode_QUOTA_EXCEEDED the sending rate of the project or the
+	// device was exceeded, retry later
+	ErrorCode_QUOTA_EXCEEDED ErrorCode = "quota-exceeded"
+	// ErrorCode_UNAVAILABLE FCM is overloaded, retry later
+	ErrorCode_UNAVAILABLE ErrorCode = "unavailable"
+	// ErrorCode_INTERNAL FCM failed internally, retry later
+	ErrorCode_INTERNAL ErrorCode = "internal"
+	// ErrorCode_THIRD_PARTY_AUTH the APNs certificate or web push key
+	// was rejected
+	ErrorCode_THIRD_PARTY_AUTH ErrorCode = "third-party-auth"
+	// ErrorCode_UNKNOWN errors FCM didn't classify, and transport errors
+	ErrorCode_UNKNOWN ErrorCode = "unknown"
+)
+
+const (
+	// Operation_MULTICAST a SendEachForMulticast call
+	Operation_MULTICAST = "multicast"
+	// Operation_SEND_EACH a SendEach call
+	Operation_SEND_EACH = "send_each"
+
+	// Operation_GET_INFO an Instance ID info call
+	Operation_GET_INFO = "get_info"
+	// Operation_SUBSCRIBE an Instance ID topic subscription
+	Operation_SUBSCRIBE = "subscribe"
+	// Operation_BATCH_SUBSCRIBE an Instance ID batch subscription
+	Operation_BATCH_SUBSCRIBE = "batch_subscribe"
+	// Operation_BATCH_UNSUBSCRIBE an Instance ID batch unsubscription
+	Operation_BATCH_UNSUBSCRIBE = "batch_unsubscribe"
+	// Operation_APNS_BATCH_IMPORT an Instance ID import of APNs tokens
+	Operation_APNS_BATCH_IMPORT = "apns_batch_import"
+)
+
+// ErrorCodeOf the error code of a send error
+func ErrorCodeOf(err error) ErrorCode {
+	switch {
+	case messaging.IsUnregistered(err):
+		return ErrorCode_UNREGISTERED
+	case messaging.IsInvalidArgument(err):
+		return ErrorCode_INVALID_ARGUMENT
+	case messaging.IsSenderIDMismatch(err):
+		return ErrorCode_SENDER_ID_MISMATCH
+	case messaging.IsQuotaExceeded(err):
+		return ErrorCode_QUOTA_EXCEEDED
+	case messaging.IsUnavailable(err):
+		return ErrorCode_UNAVAILABLE
+	case messaging.IsInternal(err):
+		return ErrorCode_INTERNAL
+	case messaging.IsThirdPartyAuthError(err):
+		return ErrorCode_THIRD_PARTY_AUTH
+	}
+
+	return ErrorCode_UNKNOWN
+}
+
+// Metrics receives the measurements of the client, see SetMetrics.
+// Implementations are called from concurrent sends.
+type Metrics interface {
+	// Attempted messages handed to FCM by an operation (Operation_MULTICAST,
+	// Operation_SEND_EACH), and the tokens they target
+	Attempted(operation string, messages int, tokens int)
+	// Failed tokens or messages that failed with code
+	Failed(operation string, code ErrorCode, count int)
+	// BatchLatency time taken by a single call to FCM
+	BatchLatency(operation string, latency time.Duration)
+	// Retried a Dispatcher delivery retried, attempt counting from 2
+	Retried(attempt int)
+	// InstanceIDCall the outcome of an Instance ID call, statusCode is 0
+	// when the request failed without a response
+	InstanceIDCall(operation string, statusCode int, err error, latency time.Duration)
+}
+
+// NoopMetrics discards every measurement, the default Metrics
+type NoopMetrics struct{}
+
+// Attempted discards the attempted sends
+func (NoopMetrics) Attempted(string, int, int) {}
+
+// Failed discards the failed sends
+func (NoopMetrics) Failed(string, ErrorCode, int) {}
+
+// BatchLatency discards the latency of the call
+func (NoopMetrics) BatchLatency(string, time.Duration) {}
+
+// Retried discards the retry
+func (NoopMetrics) Retried(int) {}
+
+// InstanceIDCall discards the outcome of the Instance ID call
+func (NoopMetrics) InstanceIDCall(string, int, error, time.Duration) {}
+
+// SetMetrics sets where the client reports its measurements
+func (this *FcmClient) SetMetrics(metrics Metrics) *FcmClient {
+	this.Metrics = metrics
+
+	return this
+}
+
+// metrics the Metrics of the client, NoopMetrics when none is set
+func (this *FcmClient) metrics() Metrics {
+	if this.Metrics == nil {
+		return NoopMetrics{}
+	}
+
+	return this.Metrics
+}
+
+// instrument wraps client to report every call to the client Metrics,
+// pass it through the client Interceptors, and trace it within the span
+// of the calling send
+func (this *FcmClient) instrument(client MessagingClient) MessagingClient {
+	if this.Metrics != nil {
+		client = &measuredClient{client: client, metrics: this.Metrics}
+	}
+	client = this.intercept(client)
+	if this.TracerProvider != nil {
+		client = &tracedClient{client: client, tracer: this.tracer(), redactor: this.redactor()}
+	}
+
+	return client
+}
+
+// measuredClient a MessagingClient reporting its calls to metrics
+type measuredClient struct {
+	client  MessagingClient
+	metrics Metrics
+}
+
+func (this *measuredClient) SendEachForMulticast(ctx context.Context, message *messaging.MulticastMessage) (*messaging.BatchResponse, error) {
+	this.metrics.Attempted(Operation_MULTICAST, 1, len(message.Tokens))
+
+	start := time.Now()
+	response, err := this.client.SendEachForMulticast(ctx, message)
+	this.metrics.BatchLatency(Operation_MULTICAST, time.Since(start))
+	this.observe(Operation_MULTICAST, len(message.Tokens), response, err)
+
+	return response, err
+}
+
+func (this *measuredClient) SendEach(ctx context.Context, messages []*messaging.Message) (*messaging.BatchResponse, error) {
+	this.metrics.Attempted(Operation_SEND_EACH, len(messages), len(messages))
+
+	start := time.Now()
+	response, err := sendEachWith(ctx, this.client, messages)
+	this.metrics.BatchLatency(Operation_SEND_EACH, time.Since(start))
+	this.observe(Operation_SEND_EACH, len(messages), response, err)
+
+	return response, err
+}
+
+// observe reports the failures of a call, all of its sends when the
+// whole call failed
+func (this *measuredClient) observe(operation string, sends int, response *messaging.BatchResponse, err error) {
+	if err != nil {
+		this.metrics.Failed(operation, ErrorCodeOf(err), sends)
+		return
+	}
+	if response == nil {
+		return
+	}
+
+	failures := make(map[ErrorCode]int)
+	for _, sendResponse := range response.Responses {
+		if sendResponse != nil && !sendResponse.Success {
+			failures[ErrorCodeOf(sendResponse.Error)]++
+		}
+	}
+	for code, count := range failures {
+		this.metrics.Failed(operation, code, count)
+	}
+}
+
+// doInstanceID sends an Instance ID request, reporting its outcome. The
+// tokens in the request URL are redacted from the error.
+func (this *FcmClient) doInstanceID(operation string, request *http.Request, tokens ...string) (*http.Response, error) {
+	client := &http.Client{}
+
+	start := time.Now()
+	response, err := client.Do(request)
+	err = this.redactor().Error(err, tokens...)
+
+	statusCode := 0
+	if response != nil {
+		statusCode = response.StatusCode
+	}
+	this.metrics().InstanceIDCall(operation, statusCode, err, time.Since(start))
+
+	return response, err
+}
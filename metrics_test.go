@@ -0,0 +1,171 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	messaging "firebase.google.com/go/v4/messaging"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingMetrics struct {
+	mu         sync.Mutex
+	messages   map[string]int
+	tokens     map[string]int
+	failures   map[ErrorCode]int
+	latencies  map[string]int
+	retries    []int
+	instanceID []int
+}
+
+func newRecordingMetrics() *recordingMetrics {
+	return &recordingMetrics{
+		messages:  make(map[string]int),
+		tokens:    make(map[string]int),
+		failures:  make(map[ErrorCode]int),
+		latencies: make(map[string]int),
+	}
+}
+
+func (m *recordingMetrics) Attempted(operation string, messages int, tokens int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages[operation] += messages
+	m.tokens[operation] += tokens
+}
+
+func (m *recordingMetrics) Failed(operation string, code ErrorCode, count int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures[code] += count
+}
+
+func (m *recordingMetrics) BatchLatency(operation string, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.latencies[operation]++
+}
+
+func (m *recordingMetrics) Retried(attempt int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retries = append(m.retries, attempt)
+}
+
+func (m *recordingMetrics) InstanceIDCall(operation string, statusCode int, err error, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.instanceID = append(m.instanceID, statusCode)
+}
+
+func TestMetrics_Send(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.Anything).Return(&messaging.BatchResponse{
+		SuccessCount: 1,
+		FailureCount: 2,
+		Responses: []*messaging.SendResponse{
+			{Success: true, MessageID: "123"},
+			{Error: errors.New("bad token")},
+			{Error: errors.New("bad token")},
+		},
+	}, nil).Once()
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.Anything).Return((*messaging.BatchResponse)(nil), errors.New("down")).Once()
+
+	metrics := newRecordingMetrics()
+	c := NewFcmClient("key").
+		SetMessagingClient(messagingClientMock).
+		SetMetrics(metrics).
+		NewFcmRegIdsMsg([]string{"token0", "token1", "token2"}, nil)
+
+	_, err := c.Send()
+	require.Nil(t, err)
+	_, err = c.Send()
+	require.NotNil(t, err)
+
+	require.Equal(t, 2, metrics.messages[Operation_MULTICAST])
+	require.Equal(t, 6, metrics.tokens[Operation_MULTICAST])
+	require.Equal(t, map[ErrorCode]int{ErrorCode_UNKNOWN: 5}, metrics.failures)
+	require.Equal(t, 2, metrics.latencies[Operation_MULTICAST])
+	messagingClientMock.AssertExpectations(t)
+}
+
+func TestMetrics_SendEach(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEach", mock.Anything, mock.Anything).Return(&messaging.BatchResponse{
+		SuccessCount: 2,
+		Responses: []*messaging.SendResponse{
+			{Success: true, MessageID: "1"},
+			{Success: true, MessageID: "2"},
+		},
+	}, nil).Once()
+
+	metrics := newRecordingMetrics()
+	c := NewFcmClient("key").SetMessagingClient(messagingClientMock).SetMetrics(metrics)
+
+	msg := FcmMsg{Notification: &NotificationPayload{Title: "title"}}
+	_, err := c.SendEach([]RecipientMessage{
+		{RecipientID: "a", Token: "token0", Message: msg},
+		{RecipientID: "b", Token: "token1", Message: msg},
+	}, SendEachOptions{})
+	require.Nil(t, err)
+
+	require.Equal(t, 2, metrics.messages[Operation_SEND_EACH])
+	require.Equal(t, 1, metrics.latencies[Operation_SEND_EACH])
+	require.Empty(t, metrics.failures)
+}
+
+func TestMetrics_DispatcherRetries(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.Anything).Return((*messaging.BatchResponse)(nil), errors.New("down"))
+
+	metrics := newRecordingMetrics()
+	c := NewFcmClient("key").SetMessagingClient(messagingClientMock).SetMetrics(metrics)
+
+	done := make(chan struct{})
+	d := NewDispatcher(c, NewMemoryOutbox(), DispatcherOptions{
+		MaxAttempts:  3,
+		RetryBackoff: time.Millisecond,
+		PollInterval: time.Millisecond,
+		OnResult: func(entry *OutboxEntry, status *FcmResponseStatus, err error) {
+			close(done)
+		},
+	})
+	defer d.Close(context.Background())
+
+	_, err := d.Enqueue(FcmMsg{RegistrationIds: []string{"token0"}})
+	require.Nil(t, err)
+	<-done
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	require.Equal(t, []int{2, 3}, metrics.retries)
+}
+
+func TestMetrics_InstanceIDCall(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	metrics := newRecordingMetrics()
+	c := NewFcmClient("key").SetMetrics(metrics)
+
+	request, err := http.NewRequest("GET", srv.URL, nil)
+	require.Nil(t, err)
+	response, err := c.doInstanceID(Operation_GET_INFO, request)
+	require.Nil(t, err)
+	response.Body.Close()
+
+	request, err = http.NewRequest("GET", "http://127.0.0.1:0", nil)
+	require.Nil(t, err)
+	_, err = c.doInstanceID(Operation_GET_INFO, request)
+	require.NotNil(t, err)
+
+	require.Equal(t, []int{http.StatusNotFound, 0}, metrics.instanceID)
+}
@@ -0,0 +1,94 @@
+package fcm
+
+import (
+	"context"
+
+	messaging "firebase.google.com/go/v4/messaging"
+)
+
+// multicastGroup tokens of a message receiving the same notification
+type multicastGroup struct {
+	notification *NotificationPayload
+	// badge the badge count of the group, nil to keep the message one
+	badge *int
+	// indexes of the tokens in the message
+	indexes []int
+	tokens  []string
+}
+
+// multicastGroups splits the message tokens into groups receiving a
+// different notification (locale, badge count), nil when every token
+// receives the message as it is
+func (this *FcmClient) multicastGroups(tokens []string) ([]*multicastGroup, error) {
+	groups := this.localeGroups(tokens)
+
+	return this.badgeGroups(groups, tokens)
+}
+
+// sendMulticast sends the message, as one multicast per group when the
+// tokens receive different notifications. The responses are merged in
+// the order of the message tokens.
+func (this *FcmClient) sendMulticast(ctx context.Context, client MessagingClient, message *messaging.MulticastMessage) (*messaging.BatchResponse, error) {
+	groups, err := this.multicastGroups(message.Tokens)
+	if err != nil {
+		return nil, err
+	}
+	if groups == nil {
+		return client.SendEachForMulticast(ctx, message)
+	}
+
+	merged := &messaging.BatchResponse{Responses: make([]*messaging.SendResponse, len(message.Tokens))}
+	var firstErr error
+	failedGroups := 0
+	for _, group := range groups {
+		batchResponse, err := this.sendGroup(ctx, client, group)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			failedGroups++
+		}
+
+		for i, index := range group.indexes {
+			response := &messaging.SendResponse{Error: err}
+			if err == nil && i < len(batchResponse.Responses) {
+				response = batchResponse.Responses[i]
+			}
+			merged.Responses[index] = response
+
+			if response.Success {
+				merged.SuccessCount++
+			} else {
+				merged.FailureCount++
+			}
+		}
+	}
+
+	this.rollbackBadges(message.Tokens, merged)
+
+	if failedGroups == len(groups) {
+		return nil, firstErr
+	}
+
+	return merged, nil
+}
+
+// sendGroup sends the group notification to the group tokens
+func (this *FcmClient) sendGroup(ctx context.Context, client MessagingClient, group *multicastGroup) (*messaging.BatchResponse, error) {
+	msg := this.Message
+	msg.Notification = group.notification
+
+	message, err := msg.makeMulticastMessage()
+	if err != nil {
+		return nil, err
+	}
+	if group.badge != nil {
+		setBadge(message, *group.badge)
+	}
+	if err := msg.fitPayload(message); err != nil {
+		return nil, err
+	}
+	message.Tokens = group.tokens
+
+	return client.SendEachForMulticast(ctx, message)
+}
@@ -0,0 +1,160 @@
+package fcm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	messaging "firebase.google.com/go/v4/messaging"
+)
+
+const (
+	// MAX_ANDROID_ACTIONS action buttons Android notifications show
+	MAX_ANDROID_ACTIONS = 3
+	// MAX_APNS_ACTIONS actions iOS shows for a notification category
+	MAX_APNS_ACTIONS = 4
+	// MAX_WEBPUSH_ACTIONS actions most browsers show
+	MAX_WEBPUSH_ACTIONS = 2
+	// actions_data_key data key of the actions, read by older app versions
+	actions_data_key = "actions"
+)
+
+// NotificationAction a button shown with the notification
+type NotificationAction struct {
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	Icon     string `json:"icon,omitempty"`
+	DeepLink string `json:"deeplink,omitempty"`
+	// Foreground the action opens the app
+	Foreground bool `json:"foreground,omitempty"`
+	// Destructive the action is shown as destructive (iOS)
+	Destructive bool `json:"destructive,omitempty"`
+}
+
+// SetNotificationActions sets the actions of the notification. The apps
+// register the buttons of a category up front: it is sent as the APNs
+// category and the Android click_action. The actions data key carries the
+// actions with their deep links and options to the apps, web push gets
+// the buttons and, in the notification data, the whole actions.
+func (this *FcmClient) SetNotificationActions(category string, actions ...NotificationAction) *FcmClient {
+	this.Message.ActionCategory = category
+	this.Message.Actions = actions
+
+	return this
+}
+
+// legacyActions the actions in the format of the actions data key
+func legacyActions(actions []NotificationAction) []Action {
+	result := make([]Action, 0, len(actions))
+	for _, action := range actions {
+		result = append(result, Action{
+			Type:        action.Title,
+			Value:       action.ID,
+			DeepLink:    action.DeepLink,
+			Foreground:  action.Foreground,
+			Destructive: action.Destructive,
+		})
+	}
+
+	return result
+}
+
+// applyActions adds the notification actions to every platform config
+func (this *FcmMsg) applyActions(message *messaging.MulticastMessage) {
+	if len(this.Actions) == 0 && this.ActionCategory == "" {
+		return
+	}
+
+	if _, ok := message.Data[actions_data_key]; !ok && len(this.Actions) > 0 {
+		// marshalling a slice of structs of strings can't fail
+		encoded, _ := json.Marshal(legacyActions(this.Actions))
+		if message.Data == nil {
+			message.Data = make(map[string]string)
+		}
+		message.Data[actions_data_key] = string(encoded)
+	}
+
+	// buttons belong to a displayed notification, data messages only get the data key
+	if this.Notification == nil {
+		return
+	}
+
+	if this.ActionCategory != "" {
+		message.APNS.Payload.Aps.Category = this.ActionCategory
+		ensureAndroidNotification(message).ClickAction = this.ActionCategory
+	}
+
+	if len(this.Actions) > 0 {
+		// browsers show fewer buttons than the apps, the first ones are kept
+		actions := this.Actions
+		if len(actions) > MAX_WEBPUSH_ACTIONS {
+			actions = actions[:MAX_WEBPUSH_ACTIONS]
+		}
+
+		webpushActions := make([]*messaging.WebpushNotificationAction, 0, len(actions))
+		for _, action := range actions {
+			webpushActions = append(webpushActions, &messaging.WebpushNotificationAction{
+				Action: action.ID,
+				Title:  action.Title,
+				Icon:   action.Icon,
+			})
+		}
+
+		if message.Webpush == nil {
+			message.Webpush = &messaging.WebpushConfig{}
+		}
+		if message.Webpush.Notification == nil {
+			message.Webpush.Notification = &messaging.WebpushNotification{
+				Title: this.Notification.Title,
+				Body:  this.Notification.Body,
+			}
+		}
+		message.Webpush.Notification.Actions = webpushActions
+		// the service worker reads the deep link and options of the clicked action
+		if message.Webpush.Notification.Data == nil {
+			message.Webpush.Notification.Data = map[string]interface{}{actions_data_key: actions}
+		}
+	}
+}
+
+// validateActions checks the actions against the platform limits
+func (this *FcmMsg) validateActions(v *validator) {
+	if len(this.Actions) == 0 {
+		return
+	}
+
+	if this.ActionCategory == "" {
+		v.add("action_category", "required with actions, the apps show the buttons of the category")
+	}
+	if len(this.Actions) > MAX_ANDROID_ACTIONS {
+		v.add("actions", "Android shows at most %d actions, got %d", MAX_ANDROID_ACTIONS, len(this.Actions))
+	}
+	if len(this.Actions) > MAX_APNS_ACTIONS {
+		v.add("actions", "APNs shows at most %d actions, got %d", MAX_APNS_ACTIONS, len(this.Actions))
+	}
+
+	ids := make(map[string]bool)
+	for i, action := range this.Actions {
+		path := fmt.Sprintf("actions[%d]", i)
+
+		switch {
+		case action.ID == "":
+			v.add(path+".id", "required")
+		case ids[action.ID]:
+			v.add(path+".id", "duplicate action id %q", action.ID)
+		}
+		ids[action.ID] = true
+
+		if action.Title == "" {
+			v.add(path+".title", "required")
+		}
+		if action.Icon != "" {
+			validateHttpsUrl(v, path+".icon", action.Icon)
+		}
+		if action.DeepLink != "" {
+			if parsed, err := url.Parse(action.DeepLink); err != nil || parsed.Scheme == "" {
+				v.add(path+".deeplink", "must be an absolute URL, got %q", action.DeepLink)
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package fcm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testActions() []NotificationAction {
+	return []NotificationAction{
+		{ID: "like", Title: "Like", Icon: "https://example.com/like.png"},
+		{ID: "reply", Title: "Reply", DeepLink: "fishbrain://catches/42/reply", Foreground: true},
+		{ID: "mute", Title: "Mute", Destructive: true},
+	}
+}
+
+func TestNotificationActions_MappedToEveryPlatform(t *testing.T) {
+	actions := testActions()[:2]
+	actions[0].Destructive = true
+
+	c := NewFcmClient("key").
+		NewFcmRegIdsMsg([]string{"token0"}, nil).
+		SetNotificationPayload(&NotificationPayload{Title: "New like", Body: "Anna liked your catch"}).
+		SetNotificationActions("CATCH_LIKED", actions...)
+	require.Nil(t, c.Validate())
+
+	message, err := c.Message.makeMulticastMessage()
+	require.Nil(t, err)
+
+	require.Equal(t, "CATCH_LIKED", message.APNS.Payload.Aps.Category)
+	require.Equal(t, "CATCH_LIKED", message.Android.Notification.ClickAction)
+
+	require.Len(t, message.Webpush.Notification.Actions, 2)
+	require.Equal(t, "like", message.Webpush.Notification.Actions[0].Action)
+	require.Equal(t, "https://example.com/like.png", message.Webpush.Notification.Actions[0].Icon)
+	require.Equal(t, "New like", message.Webpush.Notification.Title)
+	require.Equal(t, map[string]interface{}{"actions": actions}, message.Webpush.Notification.Data)
+
+	require.Equal(t, `[{"type":"Like","value":"like","destructive":true},{"type":"Reply","value":"reply","deeplink":"fishbrain://catches/42/reply","foreground":true}]`, message.Data["actions"])
+}
+
+func TestNotificationActions_DataMessage(t *testing.T) {
+	msg := FcmMsg{
+		RegistrationIds: []string{"token0"},
+		Data:            map[string]interface{}{"actions": []Action{{Type: "Custom", Value: "custom"}}},
+		ActionCategory:  "CATCH_LIKED",
+		Actions:         testActions()[:1],
+	}
+
+	message, err := msg.makeMulticastMessage()
+	require.Nil(t, err)
+
+	// actions already in the data are kept, no notification configs are added
+	require.Equal(t, `[{"type":"Custom","value":"custom"}]`, message.Data["actions"])
+	require.Nil(t, message.Android)
+	require.Nil(t, message.Webpush)
+}
+
+func TestNotificationActions_Validate(t *testing.T) {
+	actions := append(testActions(),
+		NotificationAction{ID: "like", Icon: "http://example.com/icon.png", DeepLink: "catches/42"},
+	)
+	msg := FcmMsg{RegistrationIds: []string{"token0"}, Actions: actions}
+
+	require.Equal(t, []string{
+		"action_category",
+		"actions",
+		"actions[3].id",
+		"actions[3].title",
+		"actions[3].icon",
+		"actions[3].deeplink",
+	}, validationFields(t, msg.Validate()))
+
+	// web push shows fewer buttons than the apps, it doesn't limit them
+	msg = FcmMsg{RegistrationIds: []string{"token0"}, ActionCategory: "CATCH_LIKED", Actions: testActions()}
+	msg.Notification = &NotificationPayload{Title: "New like"}
+	require.Nil(t, msg.Validate())
+}
+
+func TestNotificationActions_WebpushTruncated(t *testing.T) {
+	c := NewFcmClient("key").
+		NewFcmRegIdsMsg([]string{"token0"}, nil).
+		SetNotificationPayload(&NotificationPayload{Title: "New like"}).
+		SetNotificationActions("CATCH_LIKED", testActions()...)
+	require.Nil(t, c.Validate())
+
+	message, err := c.Message.makeMulticastMessage()
+	require.Nil(t, err)
+
+	// the apps get every action, browsers the first MAX_WEBPUSH_ACTIONS
+	require.Contains(t, message.Data["actions"], `"value":"mute"`)
+	require.Len(t, message.Webpush.Notification.Actions, MAX_WEBPUSH_ACTIONS)
+	require.Equal(t, "reply", message.Webpush.Notification.Actions[1].Action)
+	require.Equal(t, map[string]interface{}{"actions": testActions()[:MAX_WEBPUSH_ACTIONS]}, message.Webpush.Notification.Data)
+}
@@ -0,0 +1,390 @@
+package fcm
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// outbox_op_put log record storing (or replacing) an entry
+	outbox_op_put = "put"
+	// outbox_op_ack log record removing an entry
+	outbox_op_ack = "ack"
+)
+
+var (
+	// ErrOutboxClosed returned when using an outbox after Close
+	ErrOutboxClosed = errors.New("fcm: outbox is closed")
+)
+
+// OutboxEntry a message waiting in an Outbox to be delivered
+type OutboxEntry struct {
+	ID         string    `json:"id"`
+	Message    FcmMsg    `json:"message"`
+	Attempts   int       `json:"attempts,omitempty"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+	// NotBefore the entry is not handed out before this time
+	NotBefore time.Time `json:"not_before,omitempty"`
+	// Delivered tokens delivered by earlier attempts, before the entry
+	// was put back with only the tokens to retry
+	Delivered int `json:"delivered,omitempty"`
+}
+
+// Outbox queues messages until they are delivered.
+// Entries are handed out by Take and stay in the outbox until they are
+// acknowledged with Ack, so an entry taken but never acknowledged
+// (e.g. the process died mid-send) is delivered again by a durable outbox.
+type Outbox interface {
+	// Put stores an entry. Putting an entry with an existing ID replaces it
+	// and makes it available to Take again (used for retries)
+	Put(entry *OutboxEntry) error
+	// Take hands out the oldest entry due at now, ok is false when
+	// there is none. A taken entry is not handed out again until it is Put back
+	Take(now time.Time) (entry *OutboxEntry, ok bool, err error)
+	// Ack removes a delivered entry
+	Ack(id string) error
+	// Len number of entries not acknowledged yet
+	Len() (int, error)
+	// Close releases the outbox resources
+	Close() error
+}
+
+// MemoryOutbox an Outbox kept in memory, its entries are lost with the process
+type MemoryOutbox struct {
+	mu       sync.Mutex
+	entries  map[string]*OutboxEntry
+	order    []string
+	inflight map[string]bool
+	closed   bool
+}
+
+// NewMemoryOutbox creates an empty in-memory outbox
+func NewMemoryOutbox() *MemoryOutbox {
+	return &MemoryOutbox{
+		entries:  make(map[string]*OutboxEntry),
+		inflight: make(map[string]bool),
+	}
+}
+
+// Put stores an entry in the outbox
+func (this *MemoryOutbox) Put(entry *OutboxEntry) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.closed {
+		return ErrOutboxClosed
+	}
+
+	this.put(entry)
+
+	return nil
+}
+
+// put stores an entry, the caller holds the lock
+func (this *MemoryOutbox) put(entry *OutboxEntry) {
+	if _, ok := this.entries[entry.ID]; !ok {
+		this.order = append(this.order, entry.ID)
+	}
+	this.entries[entry.ID] = entry
+	delete(this.inflight, entry.ID)
+}
+
+// Take hands out the oldest entry due at now
+func (this *MemoryOutbox) Take(now time.Time) (*OutboxEntry, bool, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.closed {
+		return nil, false, ErrOutboxClosed
+	}
+
+	for _, id := range this.order {
+		entry := this.entries[id]
+		if this.inflight[id] || entry.NotBefore.After(now) {
+			continue
+		}
+		this.inflight[id] = true
+		taken := *entry
+		return &taken, true, nil
+	}
+
+	return nil, false, nil
+}
+
+// Ack removes an entry from the outbox
+func (this *MemoryOutbox) Ack(id string) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.closed {
+		return ErrOutboxClosed
+	}
+
+	this.ack(id)
+
+	return nil
+}
+
+// ack removes an entry, the caller holds the lock
+func (this *MemoryOutbox) ack(id string) {
+	if _, ok := this.entries[id]; !ok {
+		return
+	}
+	delete(this.entries, id)
+	delete(this.inflight, id)
+	for i, v := range this.order {
+		if v == id {
+			this.order = append(this.order[:i], this.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// Len number of entries not acknowledged yet
+func (this *MemoryOutbox) Len() (int, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	return len(this.entries), nil
+}
+
+// pending the entries not acknowledged yet, oldest first
+func (this *MemoryOutbox) pending() []*OutboxEntry {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	result := make([]*OutboxEntry, 0, len(this.order))
+	for _, id := range this.order {
+		result = append(result, this.entries[id])
+	}
+
+	return result
+}
+
+// Close closes the outbox, the queued entries are dropped
+func (this *MemoryOutbox) Close() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.closed = true
+
+	return nil
+}
+
+// outboxRecord a single line of the FileOutbox log
+type outboxRecord struct {
+	Op    string       `json:"op"`
+	ID    string       `json:"id,omitempty"`
+	Entry *OutboxEntry `json:"entry,omitempty"`
+}
+
+// FileOutbox an Outbox backed by an append-only log file, so queued
+// messages survive a process restart. Entries taken but not acknowledged
+// before the restart are handed out again.
+type FileOutbox struct {
+	mu     sync.Mutex
+	path   string
+	file   *os.File
+	memory *MemoryOutbox
+}
+
+// OpenFileOutbox opens (or creates) the outbox log at path, replaying the
+// entries not acknowledged yet. The log is compacted on open.
+func OpenFileOutbox(path string) (*FileOutbox, error) {
+	outbox := &FileOutbox{
+		path:   path,
+		memory: NewMemoryOutbox(),
+	}
+
+	if err := outbox.replay(); err != nil {
+		return nil, err
+	}
+
+	if err := outbox.Compact(); err != nil {
+		return nil, err
+	}
+
+	return outbox, nil
+}
+
+// replay loads the log into memory
+func (this *FileOutbox) replay() error {
+	file, err := os.Open(this.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		record := new(outboxRecord)
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			return fmt.Errorf("fcm: outbox %s line %d: %w", this.path, line, err)
+		}
+
+		switch record.Op {
+		case outbox_op_put:
+			if record.Entry != nil {
+				this.memory.put(record.Entry)
+			}
+		case outbox_op_ack:
+			this.memory.ack(record.ID)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Compact rewrites the log keeping only the entries not acknowledged yet
+func (this *FileOutbox) Compact() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	tmpPath := this.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(tmp)
+	for _, entry := range this.memory.pending() {
+		if err := writeOutboxRecord(writer, &outboxRecord{Op: outbox_op_put, Entry: entry}); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if this.file != nil {
+		this.file.Close()
+		this.file = nil
+	}
+
+	if err := os.Rename(tmpPath, this.path); err != nil {
+		return err
+	}
+
+	if dir, err := os.Open(filepath.Dir(this.path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	this.file, err = os.OpenFile(this.path, os.O_APPEND|os.O_WRONLY, 0600)
+
+	return err
+}
+
+// append writes a record to the log and syncs it to disk
+func (this *FileOutbox) append(record *outboxRecord) error {
+	if this.file == nil {
+		return ErrOutboxClosed
+	}
+
+	if err := writeOutboxRecord(this.file, record); err != nil {
+		return err
+	}
+
+	return this.file.Sync()
+}
+
+// writeOutboxRecord writes a single log line
+func writeOutboxRecord(w io.Writer, record *outboxRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(line, '\n'))
+
+	return err
+}
+
+// Put stores an entry in the log
+func (this *FileOutbox) Put(entry *OutboxEntry) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if err := this.append(&outboxRecord{Op: outbox_op_put, Entry: entry}); err != nil {
+		return err
+	}
+
+	return this.memory.Put(entry)
+}
+
+// Take hands out the oldest entry due at now
+func (this *FileOutbox) Take(now time.Time) (*OutboxEntry, bool, error) {
+	return this.memory.Take(now)
+}
+
+// Ack removes an entry, recording it in the log
+func (this *FileOutbox) Ack(id string) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if err := this.append(&outboxRecord{Op: outbox_op_ack, ID: id}); err != nil {
+		return err
+	}
+
+	return this.memory.Ack(id)
+}
+
+// Len number of entries not acknowledged yet
+func (this *FileOutbox) Len() (int, error) {
+	return this.memory.Len()
+}
+
+// Close closes the log file, the entries not acknowledged yet stay in it
+func (this *FileOutbox) Close() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.memory.Close()
+
+	if this.file == nil {
+		return nil
+	}
+
+	err := this.file.Close()
+	this.file = nil
+
+	return err
+}
+
+// newEntryID generates a random id for queued messages
+func newEntryID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,75 @@
+package fcm
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryOutbox_TakeAck(t *testing.T) {
+	outbox := NewMemoryOutbox()
+	now := time.Now()
+
+	require.Nil(t, outbox.Put(&OutboxEntry{ID: "a", Message: FcmMsg{To: "token0"}}))
+	require.Nil(t, outbox.Put(&OutboxEntry{ID: "b", NotBefore: now.Add(time.Hour)}))
+
+	entry, ok, err := outbox.Take(now)
+	require.Nil(t, err)
+	require.True(t, ok)
+	require.Equal(t, "a", entry.ID)
+
+	// "a" is in flight and "b" is not due yet
+	_, ok, _ = outbox.Take(now)
+	require.False(t, ok)
+
+	// putting "a" back makes it available again
+	require.Nil(t, outbox.Put(entry))
+	entry, ok, _ = outbox.Take(now)
+	require.True(t, ok)
+	require.Equal(t, "a", entry.ID)
+
+	require.Nil(t, outbox.Ack("a"))
+	pending, _ := outbox.Len()
+	require.Equal(t, 1, pending)
+
+	entry, ok, _ = outbox.Take(now.Add(2 * time.Hour))
+	require.True(t, ok)
+	require.Equal(t, "b", entry.ID)
+}
+
+func TestFileOutbox_SurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.log")
+
+	outbox, err := OpenFileOutbox(path)
+	require.Nil(t, err)
+
+	require.Nil(t, outbox.Put(&OutboxEntry{ID: "a", Message: FcmMsg{To: "token0", Data: map[string]interface{}{"item_id": "1"}}}))
+	require.Nil(t, outbox.Put(&OutboxEntry{ID: "b", Message: FcmMsg{To: "token1"}}))
+	require.Nil(t, outbox.Put(&OutboxEntry{ID: "c", Message: FcmMsg{To: "token2"}}))
+	require.Nil(t, outbox.Ack("b"))
+
+	// "a" is taken but never acknowledged, as if the process died mid-send
+	_, ok, _ := outbox.Take(time.Now())
+	require.True(t, ok)
+	require.Nil(t, outbox.Close())
+
+	outbox, err = OpenFileOutbox(path)
+	require.Nil(t, err)
+	defer outbox.Close()
+
+	pending, _ := outbox.Len()
+	require.Equal(t, 2, pending)
+
+	entry, ok, err := outbox.Take(time.Now())
+	require.Nil(t, err)
+	require.True(t, ok)
+	require.Equal(t, "a", entry.ID)
+	require.Equal(t, "token0", entry.Message.To)
+	require.Equal(t, map[string]interface{}{"item_id": "1"}, entry.Message.Data)
+
+	entry, ok, _ = outbox.Take(time.Now())
+	require.True(t, ok)
+	require.Equal(t, "c", entry.ID)
+}
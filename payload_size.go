@@ -0,0 +1,211 @@
+package fcm
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	messaging "firebase.google.com/go/v4/messaging"
+)
+
+const (
+	// MAX_PAYLOAD_SIZE the maximum encoded payload size accepted by FCM, in bytes
+	MAX_PAYLOAD_SIZE = 4096
+
+	// Platform_ANDROID payload delivered to Android devices
+	Platform_ANDROID = "android"
+	// Platform_APNS payload delivered to iOS devices
+	Platform_APNS = "apns"
+	// Platform_WEBPUSH payload delivered to browsers
+	Platform_WEBPUSH = "webpush"
+
+	// payload_top_keys number of keys listed by PayloadTooLargeError
+	payload_top_keys = 5
+)
+
+// PayloadKeySize the encoded size of a single data key
+type PayloadKeySize struct {
+	Key  string
+	Size int
+}
+
+// PayloadTooLargeError returned when a message payload exceeds
+// MAX_PAYLOAD_SIZE on a platform, before sending it
+type PayloadTooLargeError struct {
+	Platform string
+	Size     int
+	Limit    int
+	// Keys the data keys contributing the most to the payload, biggest first
+	Keys []PayloadKeySize
+}
+
+// Error describes the oversized payload and its biggest keys
+func (this *PayloadTooLargeError) Error() string {
+	keys := make([]string, 0, len(this.Keys))
+	for _, key := range this.Keys {
+		keys = append(keys, fmt.Sprintf("%s (%d bytes)", key.Key, key.Size))
+	}
+
+	return fmt.Sprintf("fcm: %s payload is %d bytes, the limit is %d bytes; biggest keys: %s",
+		this.Platform, this.Size, this.Limit, strings.Join(keys, ", "))
+}
+
+// SetTrimmableKeys sets low-priority data keys that are removed, in the
+// given order, when the payload exceeds MAX_PAYLOAD_SIZE
+func (this *FcmClient) SetTrimmableKeys(keys ...string) *FcmClient {
+	this.Message.TrimmableKeys = keys
+
+	return this
+}
+
+// PayloadSizes computes the encoded payload size of the message on each platform
+func (this *FcmMsg) PayloadSizes() (map[string]int, error) {
+	message, err := this.makeMulticastMessage()
+	if err != nil {
+		return nil, err
+	}
+
+	return multicastPayloadSizes(message)
+}
+
+// ValidatePayloadSize returns a *PayloadTooLargeError when the message
+// payload exceeds MAX_PAYLOAD_SIZE on any platform, trimmable keys are not removed
+func (this *FcmMsg) ValidatePayloadSize() error {
+	message, err := this.makeMulticastMessage()
+	if err != nil {
+		return err
+	}
+
+	return checkPayloadSize(message)
+}
+
+// fitPayload removes the trimmable keys from the message data, in
+// order, until the payload fits on every platform
+func (this *FcmMsg) fitPayload(message *messaging.MulticastMessage) error {
+	err := checkPayloadSize(message)
+	if err == nil {
+		return nil
+	}
+
+	for _, key := range this.TrimmableKeys {
+		if _, ok := message.Data[key]; !ok {
+			continue
+		}
+		delete(message.Data, key)
+
+		if err = checkPayloadSize(message); err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// checkPayloadSize returns a *PayloadTooLargeError for the first
+// platform the payload exceeds MAX_PAYLOAD_SIZE on
+func checkPayloadSize(message *messaging.MulticastMessage) error {
+	sizes, err := multicastPayloadSizes(message)
+	if err != nil {
+		return err
+	}
+
+	for _, platform := range []string{Platform_ANDROID, Platform_APNS, Platform_WEBPUSH} {
+		if sizes[platform] > MAX_PAYLOAD_SIZE {
+			return &PayloadTooLargeError{
+				Platform: platform,
+				Size:     sizes[platform],
+				Limit:    MAX_PAYLOAD_SIZE,
+				Keys:     dataKeySizes(message.Data),
+			}
+		}
+	}
+
+	return nil
+}
+
+// multicastPayloadSizes encodes the payload delivered on each platform
+// the way FCM builds it: Android and web receive the data and notification,
+// on iOS the data keys are merged into the APNs payload next to "aps"
+func multicastPayloadSizes(message *messaging.MulticastMessage) (map[string]int, error) {
+	sizes := make(map[string]int)
+
+	android := map[string]interface{}{}
+	webpush := map[string]interface{}{}
+	apns := map[string]interface{}{}
+
+	if len(message.Data) > 0 {
+		android["data"] = message.Data
+		webpush["data"] = message.Data
+		for k, v := range message.Data {
+			apns[k] = v
+		}
+	}
+
+	if message.Notification != nil {
+		android["notification"] = message.Notification
+		webpush["notification"] = message.Notification
+	}
+	if message.Android != nil {
+		if message.Android.Data != nil {
+			android["data"] = message.Android.Data
+		}
+		if message.Android.Notification != nil {
+			android["android_notification"] = message.Android.Notification
+		}
+	}
+	if message.Webpush != nil {
+		if message.Webpush.Data != nil {
+			webpush["data"] = message.Webpush.Data
+		}
+		if message.Webpush.Notification != nil {
+			webpush["webpush_notification"] = message.Webpush.Notification
+		}
+	}
+	if message.APNS != nil && message.APNS.Payload != nil {
+		for k, v := range message.APNS.Payload.CustomData {
+			apns[k] = v
+		}
+		if message.APNS.Payload.Aps != nil {
+			apns["aps"] = message.APNS.Payload.Aps
+		}
+	}
+
+	for platform, payload := range map[string]interface{}{
+		Platform_ANDROID: android,
+		Platform_APNS:    apns,
+		Platform_WEBPUSH: webpush,
+	} {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		sizes[platform] = len(encoded)
+	}
+
+	return sizes, nil
+}
+
+// dataKeySizes the biggest data keys by encoded size
+func dataKeySizes(data map[string]string) []PayloadKeySize {
+	result := make([]PayloadKeySize, 0, len(data))
+	for k, v := range data {
+		key, _ := json.Marshal(k)
+		value, _ := json.Marshal(v)
+		// "key":"value",
+		result = append(result, PayloadKeySize{Key: k, Size: len(key) + len(value) + 2})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Size == result[j].Size {
+			return result[i].Key < result[j].Key
+		}
+		return result[i].Size > result[j].Size
+	})
+
+	if len(result) > payload_top_keys {
+		result = result[:payload_top_keys]
+	}
+
+	return result
+}
@@ -0,0 +1,74 @@
+package fcm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	messaging "firebase.google.com/go/v4/messaging"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func oversizedData() map[string]interface{} {
+	return map[string]interface{}{
+		"item_type":        "Post",
+		"item_id":          "123",
+		"body":             strings.Repeat("b", 1000),
+		"tracking_payload": map[string]string{"campaign": strings.Repeat("t", 3500)},
+	}
+}
+
+func TestPayloadSizes(t *testing.T) {
+	msg := FcmMsg{
+		Data:         map[string]interface{}{"item_id": "123"},
+		Notification: &NotificationPayload{Title: "title", Body: "body", Badge: "1"},
+	}
+
+	sizes, err := msg.PayloadSizes()
+	require.Nil(t, err)
+	require.Equal(t, len(`{"data":{"item_id":"123"},"notification":{"title":"title","body":"body"}}`), sizes[Platform_ANDROID])
+	require.Equal(t, len(`{"aps":{"alert":{"title":"title","body":"body"},"badge":1},"item_id":"123"}`), sizes[Platform_APNS])
+	require.Nil(t, msg.ValidatePayloadSize())
+}
+
+func TestValidatePayloadSize_TooLarge(t *testing.T) {
+	msg := FcmMsg{Data: oversizedData()}
+
+	err := msg.ValidatePayloadSize()
+	var tooLarge *PayloadTooLargeError
+	require.True(t, errors.As(err, &tooLarge))
+	require.Equal(t, MAX_PAYLOAD_SIZE, tooLarge.Limit)
+	require.Greater(t, tooLarge.Size, MAX_PAYLOAD_SIZE)
+	require.Equal(t, "tracking_payload", tooLarge.Keys[0].Key)
+	require.Equal(t, "body", tooLarge.Keys[1].Key)
+}
+
+func TestSendOnceFirebaseAdminGo_RejectsOversizedPayload(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+
+	c := NewFcmClient("key").NewFcmRegIdsMsg([]string{"token0"}, oversizedData())
+
+	_, err := c.sendOnceFirebaseAdminGo(messagingClientMock)
+	var tooLarge *PayloadTooLargeError
+	require.True(t, errors.As(err, &tooLarge))
+	messagingClientMock.AssertNotCalled(t, "SendEachForMulticast", mock.Anything, mock.Anything)
+}
+
+func TestSendOnceFirebaseAdminGo_TrimsKeysToFit(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.MatchedBy(func(mm *messaging.MulticastMessage) bool {
+		_, hasTracking := mm.Data["tracking_payload"]
+		_, hasBody := mm.Data["body"]
+		return !hasTracking && hasBody
+	})).Return(successBatchResponse(), nil)
+
+	c := NewFcmClient("key").
+		NewFcmRegIdsMsg([]string{"token0"}, oversizedData()).
+		SetTrimmableKeys("actions", "tracking_payload", "body")
+
+	res, err := c.sendOnceFirebaseAdminGo(messagingClientMock)
+	require.Nil(t, err)
+	require.True(t, res.Ok)
+	messagingClientMock.AssertExpectations(t)
+}
@@ -0,0 +1,299 @@
+package fcm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RedactionMode how device tokens show in logs, errors and printed results
+type RedactionMode string
+
+const (
+	// RedactionMode_HASH a short SHA-256 of the token, e.g. "sha256:1f2e3d4c5b6a",
+	// the same for every occurrence so a token can still be followed
+	RedactionMode_HASH RedactionMode = "hash"
+	// RedactionMode_PREFIX the first PrefixLength characters of the token
+	RedactionMode_PREFIX RedactionMode = "prefix"
+	// RedactionMode_NONE tokens in full, for local debugging. API keys and
+	// credentials are redacted in every mode
+	RedactionMode_NONE RedactionMode = "none"
+)
+
+const (
+	// REDACTED replaces API keys, credentials and tokens too short to keep a prefix of
+	REDACTED = "[REDACTED]"
+
+	// default_redaction_prefix_length characters kept by RedactionMode_PREFIX
+	default_redaction_prefix_length = 8
+	// redaction_hash_length hex characters of the token hash
+	redaction_hash_length = 12
+)
+
+var (
+	// DefaultRedactor used by PrintResults, and by clients without a Redactor
+	DefaultRedactor = NewRedactor(RedactionMode_HASH)
+
+	// fcmTokenPattern registration tokens, "<instance id>:APA91b..." or legacy "APA91b..."
+	fcmTokenPattern = regexp.MustCompile(`(?:[A-Za-z0-9_-]+:)?APA91b[A-Za-z0-9_-]{20,}`)
+	// apiKeyPattern Google API keys
+	apiKeyPattern = regexp.MustCompile(`AIza[0-9A-Za-z_-]{35}`)
+	// keyHeaderPattern the legacy "key=<server key>" authorization header
+	keyHeaderPattern = regexp.MustCompile(`\bkey=[^\s"'&,]+`)
+	// privateKeyPattern PEM private keys
+	privateKeyPattern = regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)
+	// credentialFieldPattern secret fields of credential JSON, quoted or escaped within a string
+	credentialFieldPattern = regexp.MustCompile(`(\\?"(?:private_key|private_key_id|client_secret|refresh_token|access_token)\\?"\s*:\s*)\\?"(?:[^"\\]|\\[^"])*\\?"`)
+
+	// credentialSecretFields fields of credential JSON replaced by Credentials
+	credentialSecretFields = map[string]bool{
+		"private_key":    true,
+		"private_key_id": true,
+		"client_secret":  true,
+		"refresh_token":  true,
+		"access_token":   true,
+	}
+)
+
+// Redactor hides device tokens, which are personal data, and credentials
+// in logs, errors and printed results
+type Redactor struct {
+	Mode RedactionMode
+	// PrefixLength characters of the token kept by RedactionMode_PREFIX, default 8
+	PrefixLength int
+}
+
+// NewRedactor creates a Redactor with the given token mode
+func NewRedactor(mode RedactionMode) *Redactor {
+	return &Redactor{Mode: mode}
+}
+
+// SetRedactor sets how the client redacts tokens and credentials in its
+// logs and errors
+func (this *FcmClient) SetRedactor(redactor *Redactor) *FcmClient {
+	this.Redactor = redactor
+
+	return this
+}
+
+// redactor the Redactor of the client, DefaultRedactor when none is set
+func (this *FcmClient) redactor() *Redactor {
+	if this.Redactor == nil {
+		return DefaultRedactor
+	}
+
+	return this.Redactor
+}
+
+// Token the redacted token
+func (this *Redactor) Token(token string) string {
+	if token == "" {
+		return ""
+	}
+
+	switch this.Mode {
+	case RedactionMode_NONE:
+		return token
+	case RedactionMode_PREFIX:
+		length := this.PrefixLength
+		if length <= 0 {
+			length = default_redaction_prefix_length
+		}
+		if len(token) <= length {
+			return REDACTED
+		}
+		return token[:length] + "…"
+	default:
+		sum := sha256.Sum256([]byte(token))
+		return "sha256:" + hex.EncodeToString(sum[:])[:redaction_hash_length]
+	}
+}
+
+// Tokens the redacted tokens
+func (this *Redactor) Tokens(tokens []string) []string {
+	redacted := make([]string, len(tokens))
+	for i, token := range tokens {
+		redacted[i] = this.Token(token)
+	}
+
+	return redacted
+}
+
+// APIKey the redacted API key, only telling whether one is set
+func (this *Redactor) APIKey(key string) string {
+	if key == "" {
+		return ""
+	}
+
+	return REDACTED
+}
+
+// Credentials the credential JSON with its secret fields redacted, or
+// REDACTED when it isn't a JSON object
+func (this *Redactor) Credentials(credentials []byte) string {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(credentials, &fields); err != nil {
+		return REDACTED
+	}
+
+	for field := range fields {
+		if credentialSecretFields[field] {
+			fields[field] = REDACTED
+		}
+	}
+	redacted, err := json.Marshal(fields)
+	if err != nil {
+		return REDACTED
+	}
+
+	return string(redacted)
+}
+
+// String redacts the known tokens, anything shaped like a registration
+// token, API keys and credentials in text
+func (this *Redactor) String(text string, tokens ...string) string {
+	if text == "" {
+		return text
+	}
+
+	text = privateKeyPattern.ReplaceAllString(text, REDACTED)
+	text = credentialFieldPattern.ReplaceAllStringFunc(text, func(field string) string {
+		name := credentialFieldPattern.FindStringSubmatch(field)[1]
+		quote := `"`
+		if strings.HasSuffix(field, `\"`) {
+			quote = `\"`
+		}
+		return name + quote + REDACTED + quote
+	})
+	text = apiKeyPattern.ReplaceAllString(text, REDACTED)
+	text = keyHeaderPattern.ReplaceAllString(text, "key="+REDACTED)
+
+	if this.Mode == RedactionMode_NONE {
+		return text
+	}
+
+	// longest first, so a token containing another is replaced whole
+	known := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		if token != "" {
+			known = append(known, token)
+		}
+	}
+	sort.Slice(known, func(i, j int) bool { return len(known[i]) > len(known[j]) })
+	for _, token := range known {
+		text = strings.ReplaceAll(text, token, this.Token(token))
+	}
+
+	return fcmTokenPattern.ReplaceAllStringFunc(text, this.Token)
+}
+
+// Error err with a redacted message, still matching errors.Is and
+// errors.As of the original error
+func (this *Redactor) Error(err error, tokens ...string) error {
+	if err == nil {
+		return nil
+	}
+
+	message := err.Error()
+	redacted := this.String(message, tokens...)
+	if redacted == message {
+		return err
+	}
+
+	return &redactedError{err: err, message: redacted}
+}
+
+// redactedError an error with a redacted message
+type redactedError struct {
+	err     error
+	message string
+}
+
+func (this *redactedError) Error() string {
+	return this.message
+}
+
+func (this *redactedError) Unwrap() error {
+	return this.err
+}
+
+// redactingHandler a slog.Handler redacting the message and attributes
+// of every record
+type redactingHandler struct {
+	handler  slog.Handler
+	redactor *Redactor
+}
+
+func (this *redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return this.handler.Enabled(ctx, level)
+}
+
+func (this *redactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, this.redactor.String(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(this.redactAttr(attr))
+		return true
+	})
+
+	return this.handler.Handle(ctx, redacted)
+}
+
+func (this *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		redacted[i] = this.redactAttr(attr)
+	}
+
+	return &redactingHandler{handler: this.handler.WithAttrs(redacted), redactor: this.redactor}
+}
+
+func (this *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{handler: this.handler.WithGroup(name), redactor: this.redactor}
+}
+
+// redactAttr redacts the strings, errors and other values of an attribute,
+// the values other than strings, errors and groups being logged as their
+// redacted fmt.Sprint
+func (this *redactingHandler) redactAttr(attr slog.Attr) slog.Attr {
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, this.redactor.String(value.String()))
+	case slog.KindGroup:
+		group := value.Group()
+		redacted := make([]any, len(group))
+		for i, member := range group {
+			redacted[i] = this.redactAttr(member)
+		}
+		return slog.Group(attr.Key, redacted...)
+	case slog.KindAny:
+		if err, ok := value.Any().(error); ok {
+			return slog.String(attr.Key, this.redactor.String(err.Error()))
+		}
+		return slog.String(attr.Key, this.redactor.String(fmt.Sprint(value.Any())))
+	}
+
+	return slog.Attr{Key: attr.Key, Value: value}
+}
+
+// LogValue logs the client without its API key and tokens
+func (this *FcmClient) LogValue() slog.Value {
+	to := this.Message.To
+	if !isTopicTarget(to) {
+		to = this.redactor().Token(to)
+	}
+
+	return slog.GroupValue(
+		slog.String("api_key", this.redactor().APIKey(this.ApiKey)),
+		slog.String("to", to),
+		slog.Int("tokens", len(this.Message.RegistrationIds)),
+		slog.String("condition", this.Message.Condition),
+		slog.Bool("dry_run", this.Message.DryRun),
+	)
+}
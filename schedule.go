@@ -0,0 +1,345 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// default_scheduler_max_attempts send attempts of a scheduled message before giving up
+	default_scheduler_max_attempts = 3
+	// default_scheduler_retry_backoff wait before the first retry, doubled on every further attempt
+	default_scheduler_retry_backoff = time.Minute
+)
+
+var (
+	// ErrScheduleNotFound returned for unknown scheduled message ids
+	ErrScheduleNotFound = errors.New("fcm: scheduled message not found")
+)
+
+// Clock the source of the current time, replaceable for deterministic tests
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock the wall clock
+type systemClock struct{}
+
+// Now returns time.Now()
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// ScheduledMessage a message to be sent at a future time
+type ScheduledMessage struct {
+	ID      string    `json:"id"`
+	Message FcmMsg    `json:"message"`
+	At      time.Time `json:"at"`
+	// ScheduledAt when the message was scheduled, its TimeToLive counts from here
+	ScheduledAt time.Time `json:"scheduled_at"`
+	// Attempts failed sends of the message so far
+	Attempts int `json:"attempts,omitempty"`
+}
+
+// Expired whether the message TimeToLive has passed at now
+func (this *ScheduledMessage) Expired(now time.Time) bool {
+	if this.Message.TimeToLive <= 0 {
+		return false
+	}
+
+	return now.After(this.ScheduledAt.Add(time.Duration(this.Message.TimeToLive) * time.Second))
+}
+
+// ScheduleStore stores scheduled messages until they are sent
+type ScheduleStore interface {
+	// Save stores a message, replacing the one with the same ID if any
+	Save(msg *ScheduledMessage) error
+	// Get returns a message by id, ErrScheduleNotFound if unknown
+	Get(id string) (*ScheduledMessage, error)
+	// Delete removes a message by id, ErrScheduleNotFound if unknown
+	Delete(id string) error
+	// Due returns the messages scheduled at or before now, earliest first
+	Due(now time.Time) ([]*ScheduledMessage, error)
+}
+
+// MemoryScheduleStore a ScheduleStore kept in memory
+type MemoryScheduleStore struct {
+	mu       sync.Mutex
+	messages map[string]*ScheduledMessage
+}
+
+// NewMemoryScheduleStore creates an empty in-memory schedule store
+func NewMemoryScheduleStore() *MemoryScheduleStore {
+	return &MemoryScheduleStore{
+		messages: make(map[string]*ScheduledMessage),
+	}
+}
+
+// Save stores a message
+func (this *MemoryScheduleStore) Save(msg *ScheduledMessage) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	stored := *msg
+	this.messages[msg.ID] = &stored
+
+	return nil
+}
+
+// Get returns a message by id
+func (this *MemoryScheduleStore) Get(id string) (*ScheduledMessage, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	msg, ok := this.messages[id]
+	if !ok {
+		return nil, ErrScheduleNotFound
+	}
+
+	result := *msg
+	return &result, nil
+}
+
+// Delete removes a message by id
+func (this *MemoryScheduleStore) Delete(id string) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if _, ok := this.messages[id]; !ok {
+		return ErrScheduleNotFound
+	}
+	delete(this.messages, id)
+
+	return nil
+}
+
+// Due returns the messages scheduled at or before now, earliest first
+func (this *MemoryScheduleStore) Due(now time.Time) ([]*ScheduledMessage, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	var result []*ScheduledMessage
+	for _, msg := range this.messages {
+		if !msg.At.After(now) {
+			due := *msg
+			result = append(result, &due)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].At.Before(result[j].At)
+	})
+
+	return result, nil
+}
+
+// SchedulerOptions configures a Scheduler, zero values use the defaults
+type SchedulerOptions struct {
+	// Clock source of the current time, the wall clock by default
+	Clock Clock
+	// MaxAttempts send attempts of a message before it is dropped
+	MaxAttempts int
+	// RetryBackoff wait before retrying a failed send, doubled on every
+	// further attempt
+	RetryBackoff time.Duration
+	// OnSent when set is called for every message sent, and for every
+	// message dropped after its last failed attempt
+	OnSent func(msg *ScheduledMessage, status *FcmResponseStatus, err error)
+	// OnExpired when set is called for every message dropped
+	// because its TimeToLive passed before its send time
+	OnExpired func(msg *ScheduledMessage)
+}
+
+// ScheduledResult the outcome of sending a scheduled message
+type ScheduledResult struct {
+	Message *ScheduledMessage
+	Status  *FcmResponseStatus
+	Err     error
+}
+
+// ScheduleReport the outcome of a Scheduler run
+type ScheduleReport struct {
+	// Sent the messages sent, or dropped after their last failed attempt
+	Sent []*ScheduledResult
+	// Retried the messages whose send failed, saved again to be retried
+	Retried []*ScheduledResult
+	Expired []*ScheduledMessage
+}
+
+// Scheduler sends messages at a future time through an FcmClient
+type Scheduler struct {
+	client *FcmClient
+	store  ScheduleStore
+	opts   SchedulerOptions
+
+	mu sync.Mutex
+}
+
+// NewScheduler creates a Scheduler sending the messages of store with the
+// configuration of client. Messages are sent by RunDue, or Run periodically.
+func NewScheduler(client *FcmClient, store ScheduleStore, opts SchedulerOptions) *Scheduler {
+	if opts.Clock == nil {
+		opts.Clock = systemClock{}
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = default_scheduler_max_attempts
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = default_scheduler_retry_backoff
+	}
+
+	return &Scheduler{
+		client: client,
+		store:  store,
+		opts:   opts,
+	}
+}
+
+// Schedule stores msg to be sent at the given time, and returns its id
+func (this *Scheduler) Schedule(msg FcmMsg, at time.Time) (string, error) {
+	scheduled := &ScheduledMessage{
+		ID:          newEntryID(),
+		Message:     msg,
+		At:          at,
+		ScheduledAt: this.opts.Clock.Now(),
+	}
+
+	if err := this.store.Save(scheduled); err != nil {
+		return "", err
+	}
+
+	return scheduled.ID, nil
+}
+
+// Cancel removes a scheduled message before it is sent
+func (this *Scheduler) Cancel(id string) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	return this.store.Delete(id)
+}
+
+// Reschedule moves a scheduled message to a new send time
+func (this *Scheduler) Reschedule(id string, at time.Time) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	scheduled, err := this.store.Get(id)
+	if err != nil {
+		return err
+	}
+	scheduled.At = at
+
+	return this.store.Save(scheduled)
+}
+
+// RunDue sends the messages due now, dropping the expired ones. A failed
+// send is saved again with a backoff, until MaxAttempts. Messages are
+// removed from the store before their send, so schedulers sharing a store
+// send them at most once per attempt: a message whose scheduler stops
+// during the send is lost.
+func (this *Scheduler) RunDue() (*ScheduleReport, error) {
+	now := this.opts.Clock.Now()
+	due, report, claimErr := this.claimDue(now)
+	if report == nil {
+		return nil, claimErr
+	}
+
+	for _, scheduled := range report.Expired {
+		if this.opts.OnExpired != nil {
+			this.opts.OnExpired(scheduled)
+		}
+	}
+
+	// sent without the lock, so Schedule, Cancel and Reschedule aren't
+	// blocked by the sends
+	for _, scheduled := range due {
+		status, err := this.client.withMessage(scheduled.Message).Send()
+		result := &ScheduledResult{
+			Message: scheduled,
+			Status:  status,
+			Err:     err,
+		}
+
+		if err != nil && scheduled.Attempts+1 < this.opts.MaxAttempts {
+			retry := *scheduled
+			retry.Attempts++
+			retry.At = now.Add(this.opts.RetryBackoff << uint(scheduled.Attempts))
+			if saveErr := this.save(&retry); saveErr == nil {
+				result.Message = &retry
+				report.Retried = append(report.Retried, result)
+				continue
+			}
+		}
+
+		report.Sent = append(report.Sent, result)
+		if this.opts.OnSent != nil {
+			this.opts.OnSent(scheduled, status, err)
+		}
+	}
+
+	return report, claimErr
+}
+
+// claimDue removes the messages due at now from the store, returning the
+// ones to send and a report of the expired ones. On a store error, the
+// messages already removed are returned with it, to be sent still
+func (this *Scheduler) claimDue(now time.Time) ([]*ScheduledMessage, *ScheduleReport, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	due, err := this.store.Due(now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	report := new(ScheduleReport)
+	var claimed []*ScheduledMessage
+	for _, scheduled := range due {
+		// removing first, so a message is not sent twice when
+		// several schedulers share a store
+		if err := this.store.Delete(scheduled.ID); err != nil {
+			if errors.Is(err, ErrScheduleNotFound) {
+				continue
+			}
+			return claimed, report, err
+		}
+
+		if scheduled.Expired(now) {
+			report.Expired = append(report.Expired, scheduled)
+			continue
+		}
+		claimed = append(claimed, scheduled)
+	}
+
+	return claimed, report, nil
+}
+
+// save stores scheduled under the lock
+func (this *Scheduler) save(scheduled *ScheduledMessage) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	return this.store.Save(scheduled)
+}
+
+// Run calls RunDue every interval until ctx is done
+func (this *Scheduler) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := this.RunDue(); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
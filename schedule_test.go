@@ -0,0 +1,226 @@
+package fcm
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	messaging "firebase.google.com/go/v4/messaging"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func TestScheduler_SendsWhenDue(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.Anything).Return(successBatchResponse(), nil)
+
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 20, 0, 0, 0, time.UTC)}
+	c := NewFcmClient("key").SetMessagingClient(messagingClientMock)
+	s := NewScheduler(c, NewMemoryScheduleStore(), SchedulerOptions{Clock: clock})
+
+	id, err := s.Schedule(FcmMsg{RegistrationIds: []string{"token0"}}, clock.now.Add(10*time.Hour))
+	require.Nil(t, err)
+
+	report, err := s.RunDue()
+	require.Nil(t, err)
+	require.Empty(t, report.Sent)
+
+	clock.Advance(10 * time.Hour)
+	report, err = s.RunDue()
+	require.Nil(t, err)
+	require.Len(t, report.Sent, 1)
+	require.Equal(t, id, report.Sent[0].Message.ID)
+	require.True(t, report.Sent[0].Status.Ok)
+
+	// sent only once
+	report, _ = s.RunDue()
+	require.Empty(t, report.Sent)
+	messagingClientMock.AssertNumberOfCalls(t, "SendEachForMulticast", 1)
+}
+
+func TestScheduler_CancelAndReschedule(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.Anything).Return(successBatchResponse(), nil)
+
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 20, 0, 0, 0, time.UTC)}
+	c := NewFcmClient("key").SetMessagingClient(messagingClientMock)
+	s := NewScheduler(c, NewMemoryScheduleStore(), SchedulerOptions{Clock: clock})
+
+	cancelled, _ := s.Schedule(FcmMsg{RegistrationIds: []string{"token0"}}, clock.now.Add(time.Hour))
+	moved, _ := s.Schedule(FcmMsg{RegistrationIds: []string{"token1"}}, clock.now.Add(time.Hour))
+
+	require.Nil(t, s.Cancel(cancelled))
+	require.Equal(t, ErrScheduleNotFound, s.Cancel(cancelled))
+	require.Nil(t, s.Reschedule(moved, clock.now.Add(3*time.Hour)))
+	require.Equal(t, ErrScheduleNotFound, s.Reschedule("unknown", clock.now))
+
+	clock.Advance(2 * time.Hour)
+	report, _ := s.RunDue()
+	require.Empty(t, report.Sent)
+
+	clock.Advance(time.Hour)
+	report, _ = s.RunDue()
+	require.Len(t, report.Sent, 1)
+	require.Equal(t, moved, report.Sent[0].Message.ID)
+}
+
+func TestScheduler_DropsExpired(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 20, 0, 0, 0, time.UTC)}
+	c := NewFcmClient("key").SetMessagingClient(messagingClientMock)
+
+	var expired []string
+	s := NewScheduler(c, NewMemoryScheduleStore(), SchedulerOptions{
+		Clock: clock,
+		OnExpired: func(msg *ScheduledMessage) {
+			expired = append(expired, msg.ID)
+		},
+	})
+
+	id, _ := s.Schedule(FcmMsg{RegistrationIds: []string{"token0"}, TimeToLive: 3600}, clock.now.Add(2*time.Hour))
+
+	clock.Advance(2 * time.Hour)
+	report, err := s.RunDue()
+	require.Nil(t, err)
+	require.Empty(t, report.Sent)
+	require.Len(t, report.Expired, 1)
+	require.Equal(t, []string{id}, expired)
+	messagingClientMock.AssertNotCalled(t, "SendEachForMulticast", mock.Anything, mock.Anything)
+}
+
+func TestScheduler_RetriesFailedSend(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.Anything).
+		Return((*messaging.BatchResponse)(nil), errors.New("unavailable")).Twice()
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.Anything).
+		Return(successBatchResponse(), nil).Once()
+
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 20, 0, 0, 0, time.UTC)}
+	c := NewFcmClient("key").SetMessagingClient(messagingClientMock)
+	store := NewMemoryScheduleStore()
+	s := NewScheduler(c, store, SchedulerOptions{Clock: clock, RetryBackoff: time.Minute})
+
+	id, _ := s.Schedule(FcmMsg{RegistrationIds: []string{"token0"}}, clock.now)
+
+	report, err := s.RunDue()
+	require.Nil(t, err)
+	require.Empty(t, report.Sent)
+	require.Len(t, report.Retried, 1)
+	require.NotNil(t, report.Retried[0].Err)
+
+	stored, err := store.Get(id)
+	require.Nil(t, err)
+	require.Equal(t, 1, stored.Attempts)
+	require.Equal(t, clock.now.Add(time.Minute), stored.At)
+
+	// the backoff doubles
+	clock.Advance(time.Minute)
+	report, _ = s.RunDue()
+	require.Len(t, report.Retried, 1)
+	stored, _ = store.Get(id)
+	require.Equal(t, clock.now.Add(2*time.Minute), stored.At)
+
+	clock.Advance(2 * time.Minute)
+	report, _ = s.RunDue()
+	require.Len(t, report.Sent, 1)
+	require.Nil(t, report.Sent[0].Err)
+	require.Equal(t, 2, report.Sent[0].Message.Attempts)
+
+	_, err = store.Get(id)
+	require.Equal(t, ErrScheduleNotFound, err)
+	messagingClientMock.AssertExpectations(t)
+}
+
+func TestScheduler_DropsAfterMaxAttempts(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.Anything).
+		Return((*messaging.BatchResponse)(nil), errors.New("unavailable"))
+
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 20, 0, 0, 0, time.UTC)}
+	c := NewFcmClient("key").SetMessagingClient(messagingClientMock)
+
+	var failed []error
+	s := NewScheduler(c, NewMemoryScheduleStore(), SchedulerOptions{
+		Clock:       clock,
+		MaxAttempts: 1,
+		OnSent: func(msg *ScheduledMessage, status *FcmResponseStatus, err error) {
+			failed = append(failed, err)
+		},
+	})
+
+	s.Schedule(FcmMsg{RegistrationIds: []string{"token0"}}, clock.now)
+	report, err := s.RunDue()
+	require.Nil(t, err)
+	require.Empty(t, report.Retried)
+	require.Len(t, report.Sent, 1)
+	require.Len(t, failed, 1)
+	require.NotNil(t, failed[0])
+
+	clock.Advance(time.Hour)
+	report, _ = s.RunDue()
+	require.Empty(t, report.Sent)
+	messagingClientMock.AssertNumberOfCalls(t, "SendEachForMulticast", 1)
+}
+
+func TestScheduler_SendsWithoutLock(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			close(started)
+			<-release
+		}).
+		Return(successBatchResponse(), nil).Once()
+
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 20, 0, 0, 0, time.UTC)}
+	c := NewFcmClient("key").SetMessagingClient(messagingClientMock)
+	store := NewMemoryScheduleStore()
+	s := NewScheduler(c, store, SchedulerOptions{Clock: clock})
+
+	s.Schedule(FcmMsg{RegistrationIds: []string{"token0"}}, clock.now)
+	later, _ := s.Schedule(FcmMsg{RegistrationIds: []string{"token1"}}, clock.now.Add(time.Hour))
+
+	reports := make(chan *ScheduleReport)
+	go func() {
+		report, _ := s.RunDue()
+		reports <- report
+	}()
+	<-started
+
+	// the send in flight doesn't block the other calls
+	unblocked := make(chan error)
+	go func() {
+		if err := s.Reschedule(later, clock.now.Add(2*time.Hour)); err != nil {
+			unblocked <- err
+			return
+		}
+		unblocked <- s.Cancel(later)
+	}()
+	select {
+	case err := <-unblocked:
+		require.Nil(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Reschedule and Cancel blocked by the send")
+	}
+
+	close(release)
+	require.Len(t, (<-reports).Sent, 1)
+
+	_, err := store.Get(later)
+	require.Equal(t, ErrScheduleNotFound, err)
+	messagingClientMock.AssertExpectations(t)
+}
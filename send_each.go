@@ -0,0 +1,229 @@
+package fcm
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	messaging "firebase.google.com/go/v4/messaging"
+)
+
+const (
+	// default_send_each_concurrency batches of SendEach sent at the same time
+	default_send_each_concurrency = 4
+)
+
+// RecipientMessage a message for a single token, identified by the
+// caller's own recipient id
+type RecipientMessage struct {
+	RecipientID string
+	Token       string
+	Message     FcmMsg
+}
+
+// RecipientResult the outcome of the message of a recipient
+type RecipientResult struct {
+	RecipientID string
+	Token       string
+	MessageID   string
+	// Duplicate the message was skipped, its send already completed
+	Duplicate bool
+	Err       error
+}
+
+// SendEachOptions configure SendEach, zero values use the defaults
+type SendEachOptions struct {
+	// Concurrency batches sent at the same time, default 4
+	Concurrency int
+}
+
+// SendEachResult the outcome of SendEach
+type SendEachResult struct {
+	// Results by recipient id
+	Results    map[string]*RecipientResult
+	Success    int
+	Fail       int
+	Duplicates int
+}
+
+// recipientSend a message ready to be sent, and where its result goes
+type recipientSend struct {
+	client  *FcmClient
+	message *messaging.Message
+	result  *RecipientResult
+}
+
+// SendEach sends a different message to every recipient, in SendEach
+// batches of 500 messages. The client configuration (messaging client,
+// idempotency store) is shared, the client Message is ignored. Messages
+// that can't be built fail on their own without stopping the others.
+func (this *FcmClient) SendEach(recipients []RecipientMessage, opts SendEachOptions) (*SendEachResult, error) {
+	ctx, span := this.startSpan(context.Background(), span_send_each, attr_messages.Int(len(recipients)))
+	result, err := this.sendEach(ctx, recipients, opts)
+	if result != nil {
+		for _, recipientResult := range result.Results {
+			recipientResult.Err = this.redactor().Error(recipientResult.Err, recipientResult.Token)
+		}
+		endSpan(span, err, attr_success.Int(result.Success), attr_failure.Int(result.Fail), attr_duplicates.Int(result.Duplicates))
+	} else {
+		endSpan(span, err)
+	}
+
+	return result, err
+}
+
+// sendEach sends the recipient messages within the span of ctx
+func (this *FcmClient) sendEach(ctx context.Context, recipients []RecipientMessage, opts SendEachOptions) (*SendEachResult, error) {
+	result := &SendEachResult{Results: make(map[string]*RecipientResult, len(recipients))}
+
+	var sends []*recipientSend
+	for _, recipient := range recipients {
+		if _, ok := result.Results[recipient.RecipientID]; ok {
+			releaseSends(sends)
+			return nil, fmt.Errorf("fcm: duplicate recipient id %q", recipient.RecipientID)
+		}
+
+		recipientResult := &RecipientResult{RecipientID: recipient.RecipientID, Token: recipient.Token}
+		result.Results[recipient.RecipientID] = recipientResult
+
+		send, err := this.prepareRecipientSend(recipient, recipientResult)
+		if err != nil {
+			recipientResult.Err = err
+			continue
+		}
+		if send != nil {
+			sends = append(sends, send)
+		}
+	}
+
+	if len(sends) > 0 {
+		client, err := this.batchMessagingClient(ctx)
+		if err != nil {
+			releaseSends(sends)
+			return nil, err
+		}
+
+		this.sendEachBatches(ctx, client, sends, opts)
+	}
+
+	for _, recipientResult := range result.Results {
+		switch {
+		case recipientResult.Duplicate:
+			result.Duplicates++
+		case recipientResult.Err != nil:
+			result.Fail++
+		default:
+			result.Success++
+		}
+	}
+
+	return result, nil
+}
+
+// prepareRecipientSend builds the message of a recipient, nil when its
+// send already completed
+func (this *FcmClient) prepareRecipientSend(recipient RecipientMessage, result *RecipientResult) (*recipientSend, error) {
+	msg := recipient.Message
+	msg.To = ""
+	msg.Condition = ""
+	msg.RegistrationIds = []string{recipient.Token}
+	client := this.withMessage(msg)
+
+	if client.StrictValidation {
+		if err := client.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if err := client.checkCriticalAlerts(&msg); err != nil {
+		return nil, err
+	}
+
+	multicastMessage, err := msg.makeMulticastMessage()
+	if err != nil {
+		return nil, err
+	}
+	if err := msg.fitPayload(multicastMessage); err != nil {
+		return nil, err
+	}
+
+	_, duplicates, err := client.skipDuplicates(msg.RegistrationIds)
+	if err != nil {
+		return nil, err
+	}
+	if duplicates > 0 {
+		result.Duplicate = true
+		return nil, nil
+	}
+
+	message := toMessage(multicastMessage)
+	message.Token = recipient.Token
+
+	return &recipientSend{client: client, message: message, result: result}, nil
+}
+
+// releaseSends releases the idempotency keys reserved by sends not sent
+func releaseSends(sends []*recipientSend) {
+	for _, send := range sends {
+		if err := send.client.completeSends([]string{send.result.Token}, nil); err != nil {
+			send.client.logger().Error("error releasing idempotency keys", "error", err)
+		}
+	}
+}
+
+// sendEachBatches sends the messages in batches, opts.Concurrency at a time
+func (this *FcmClient) sendEachBatches(ctx context.Context, client BatchMessagingClient, sends []*recipientSend, opts SendEachOptions) {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = default_send_each_concurrency
+	}
+
+	batches := make(chan []*recipientSend)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				sendEachBatch(ctx, client, batch)
+			}
+		}()
+	}
+
+	for start := 0; start < len(sends); start += max_send_each_messages {
+		end := start + max_send_each_messages
+		if end > len(sends) {
+			end = len(sends)
+		}
+		batches <- sends[start:end]
+	}
+	close(batches)
+	wg.Wait()
+}
+
+// sendEachBatch sends a batch and stores the result of every message
+func sendEachBatch(ctx context.Context, client BatchMessagingClient, batch []*recipientSend) {
+	messages := make([]*messaging.Message, 0, len(batch))
+	for _, send := range batch {
+		messages = append(messages, send.message)
+	}
+
+	batchResponse, err := client.SendEach(ctx, messages)
+	for i, send := range batch {
+		var single *messaging.BatchResponse
+		switch {
+		case err != nil:
+			send.result.Err = err
+		case i >= len(batchResponse.Responses):
+			send.result.Err = fmt.Errorf("fcm: no response for recipient %q", send.result.RecipientID)
+		default:
+			response := batchResponse.Responses[i]
+			send.result.MessageID = response.MessageID
+			send.result.Err = response.Error
+			single = &messaging.BatchResponse{Responses: []*messaging.SendResponse{response}}
+		}
+
+		if err := send.client.completeSends([]string{send.result.Token}, single); err != nil {
+			send.client.logger().Error("error storing idempotency keys", "error", err)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	messaging "firebase.google.com/go/v4/messaging"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// batchRecordingClient answers SendEach, failing the token "bad", and
+// records the batch sizes and the most batches in flight at once
+type batchRecordingClient struct {
+	fcmMock
+	lock        sync.Mutex
+	batchSizes  []int
+	inFlight    int
+	maxInFlight int
+}
+
+func (this *batchRecordingClient) SendEach(_ context.Context, messages []*messaging.Message) (*messaging.BatchResponse, error) {
+	this.lock.Lock()
+	this.batchSizes = append(this.batchSizes, len(messages))
+	this.inFlight++
+	if this.inFlight > this.maxInFlight {
+		this.maxInFlight = this.inFlight
+	}
+	this.lock.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	response := &messaging.BatchResponse{}
+	for _, message := range messages {
+		if message.Token == "bad" {
+			response.Responses = append(response.Responses, &messaging.SendResponse{Error: errors.New("unregistered")})
+			response.FailureCount++
+		} else {
+			response.Responses = append(response.Responses, &messaging.SendResponse{Success: true, MessageID: "msg-" + message.Data["item_id"]})
+			response.SuccessCount++
+		}
+	}
+
+	this.lock.Lock()
+	this.inFlight--
+	this.lock.Unlock()
+
+	return response, nil
+}
+
+func TestSendEach_Batches(t *testing.T) {
+	var recipients []RecipientMessage
+	for i := 0; i < 1001; i++ {
+		recipients = append(recipients, RecipientMessage{
+			RecipientID: fmt.Sprintf("user-%d", i),
+			Token:       fmt.Sprintf("token%d", i),
+			Message:     FcmMsg{Data: map[string]interface{}{"item_id": fmt.Sprint(i)}},
+		})
+	}
+	recipients[7].Token = "bad"
+
+	messagingClient := new(batchRecordingClient)
+	c := NewFcmClient("key").SetMessagingClient(messagingClient)
+
+	result, err := c.SendEach(recipients, SendEachOptions{Concurrency: 2})
+	require.Nil(t, err)
+
+	sort.Ints(messagingClient.batchSizes)
+	require.Equal(t, []int{1, 500, 500}, messagingClient.batchSizes)
+	require.LessOrEqual(t, messagingClient.maxInFlight, 2)
+
+	require.Equal(t, 1000, result.Success)
+	require.Equal(t, 1, result.Fail)
+	require.Equal(t, "msg-1000", result.Results["user-1000"].MessageID)
+	require.Equal(t, "token1000", result.Results["user-1000"].Token)
+	require.NotNil(t, result.Results["user-7"].Err)
+}
+
+func TestSendEach_InvalidAndDuplicateRecipients(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEach", mock.Anything, mock.MatchedBy(func(messages []*messaging.Message) bool {
+		return len(messages) == 1 && messages[0].Token == "token1"
+	})).Return(successBatchResponse(), nil)
+
+	c := NewFcmClient("key").
+		SetMessagingClient(messagingClientMock).
+		SetIdempotencyStore(NewMemoryIdempotencyStore(0), time.Hour)
+	require.Nil(t, c.Idempotency.MarkCompleted("catch-1/token2", time.Hour))
+
+	result, err := c.SendEach([]RecipientMessage{
+		{RecipientID: "a", Token: "token0", Message: FcmMsg{Data: "not a map"}},
+		{RecipientID: "b", Token: "token1", Message: FcmMsg{IdempotencyKey: "catch-1"}},
+		{RecipientID: "c", Token: "token2", Message: FcmMsg{IdempotencyKey: "catch-1"}},
+	}, SendEachOptions{})
+	require.Nil(t, err)
+	messagingClientMock.AssertExpectations(t)
+
+	require.NotNil(t, result.Results["a"].Err)
+	require.Equal(t, "123", result.Results["b"].MessageID)
+	require.True(t, result.Results["c"].Duplicate)
+	require.Equal(t, 1, result.Success)
+	require.Equal(t, 1, result.Fail)
+	require.Equal(t, 1, result.Duplicates)
+
+	// completed, not released
+	reserved, err := c.Idempotency.Reserve("catch-1/token1", time.Hour)
+	require.Nil(t, err)
+	require.False(t, reserved)
+
+	_, err = c.SendEach([]RecipientMessage{{RecipientID: "a"}, {RecipientID: "a"}}, SendEachOptions{})
+	require.NotNil(t, err)
+}
+
+// multicastOnlyClient a MessagingClient without SendEach, as implemented
+// outside this package before BatchMessagingClient
+type multicastOnlyClient struct{}
+
+func (multicastOnlyClient) SendEachForMulticast(context.Context, *messaging.MulticastMessage) (*messaging.BatchResponse, error) {
+	return successBatchResponse(), nil
+}
+
+func TestSendEach_RequiresBatchMessagingClient(t *testing.T) {
+	var _ BatchMessagingClient = (*messaging.Client)(nil)
+
+	msg := FcmMsg{Notification: &NotificationPayload{Title: "title"}}
+	recipients := []RecipientMessage{{RecipientID: "a", Token: "token0", Message: msg}}
+
+	c := NewFcmClient("key").SetMessagingClient(multicastOnlyClient{})
+	_, err := c.SendEach(recipients, SendEachOptions{})
+	require.True(t, errors.Is(err, ErrSendEachNotSupported))
+
+	_, err = c.SendToTopics([]string{"news"})
+	require.True(t, errors.Is(err, ErrSendEachNotSupported))
+
+	// wrapping the client doesn't hide it
+	_, err = c.SetMetrics(newRecordingMetrics()).SetInterceptors(ChainInterceptors()).SendEach(recipients, SendEachOptions{})
+	require.True(t, errors.Is(err, ErrSendEachNotSupported))
+
+	// multicasts still work
+	status, err := c.NewFcmRegIdsMsg([]string{"token0"}, nil).Send()
+	require.Nil(t, err)
+	require.Equal(t, 1, status.Success)
+}
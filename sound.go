@@ -0,0 +1,160 @@
+package fcm
+
+import (
+	"errors"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	messaging "firebase.google.com/go/v4/messaging"
+)
+
+const (
+	// default_sound the platform default notification sound
+	default_sound = "default"
+)
+
+var (
+	// ErrCriticalAlertsDisabled returned for critical sounds and the
+	// critical interruption level sent by a client without EnableCriticalAlerts
+	ErrCriticalAlertsDisabled = errors.New("fcm: critical alerts need EnableCriticalAlerts")
+
+	// androidSoundPattern res/raw resource names, optionally with the file extension
+	androidSoundPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*(\.(mp3|ogg|wav))?$`)
+
+	// apnsSoundExtensions sound file formats iOS plays
+	apnsSoundExtensions = map[string]bool{".aiff": true, ".wav": true, ".caf": true}
+)
+
+// SoundConfig the notification sound of each platform, replacing the
+// notification Sound
+type SoundConfig struct {
+	Android *AndroidSound `json:"android,omitempty"`
+	APNS    *APNSSound    `json:"apns,omitempty"`
+}
+
+// AndroidSound the sound of Android notifications. Since Android 8 the
+// sound is set by the notification channel, so custom sounds go with the
+// channel they were created for.
+type AndroidSound struct {
+	// Sound "default" or a res/raw resource, e.g. "storm_alert" or "storm_alert.ogg"
+	Sound     string `json:"sound,omitempty"`
+	ChannelID string `json:"channel_id,omitempty"`
+}
+
+// APNSSound the sound of iOS notifications
+type APNSSound struct {
+	// Name "default" or a sound file of the app bundle (.aiff, .wav or .caf)
+	Name string `json:"name,omitempty"`
+	// Critical plays the sound even when muted or in Do Not Disturb, for
+	// safety warnings. Needs the Apple critical alerts entitlement, see
+	// EnableCriticalAlerts
+	Critical bool `json:"critical,omitempty"`
+	// Volume of critical sounds, between 0 and 1
+	Volume float64 `json:"volume,omitempty"`
+}
+
+// SetAndroidSound sets the sound of Android notifications, and the channel it belongs to
+func (this *FcmClient) SetAndroidSound(sound string, channelID string) *FcmClient {
+	this.soundConfig().Android = &AndroidSound{Sound: sound, ChannelID: channelID}
+
+	return this
+}
+
+// SetAPNSSound sets the sound file of iOS notifications
+func (this *FcmClient) SetAPNSSound(name string) *FcmClient {
+	this.soundConfig().APNS = &APNSSound{Name: name}
+
+	return this
+}
+
+// SetCriticalSound sets an iOS critical alert sound, played at volume
+// (0 to 1) even when the device is muted. Sends fail unless the client
+// opted in with EnableCriticalAlerts.
+func (this *FcmClient) SetCriticalSound(name string, volume float64) *FcmClient {
+	this.soundConfig().APNS = &APNSSound{Name: name, Critical: true, Volume: volume}
+
+	return this
+}
+
+// EnableCriticalAlerts opts in to sending critical sounds and the critical
+// interruption level, only for apps granted the Apple critical alerts entitlement
+func (this *FcmClient) EnableCriticalAlerts(enabled bool) *FcmClient {
+	this.CriticalAlerts = enabled
+
+	return this
+}
+
+// soundConfig the sound config of the message, created when missing
+func (this *FcmClient) soundConfig() *SoundConfig {
+	if this.Message.Sound == nil {
+		this.Message.Sound = &SoundConfig{}
+	}
+
+	return this.Message.Sound
+}
+
+// isCritical whether the message plays a critical sound or has the
+// critical interruption level
+func (this *FcmMsg) isCritical() bool {
+	return (this.Sound != nil && this.Sound.APNS != nil && this.Sound.APNS.Critical) ||
+		(this.APNS != nil && this.APNS.InterruptionLevel == InterruptionLevel_CRITICAL)
+}
+
+// checkCriticalAlerts refuses critical alerts without the client opt-in
+func (this *FcmClient) checkCriticalAlerts(msg *FcmMsg) error {
+	if msg.isCritical() && !this.CriticalAlerts {
+		return ErrCriticalAlertsDisabled
+	}
+
+	return nil
+}
+
+// applySound sets the sound of every platform
+func (this *SoundConfig) applySound(message *messaging.MulticastMessage) {
+	if this.Android != nil {
+		androidNotification := ensureAndroidNotification(message)
+		androidNotification.Sound = this.Android.Sound
+		androidNotification.DefaultSound = this.Android.Sound == default_sound
+		if this.Android.ChannelID != "" {
+			androidNotification.ChannelID = this.Android.ChannelID
+		}
+	}
+
+	if this.APNS != nil {
+		aps := message.APNS.Payload.Aps
+		if this.APNS.Critical {
+			aps.Sound = ""
+			aps.CriticalSound = &messaging.CriticalSound{
+				Critical: true,
+				Name:     this.APNS.Name,
+				Volume:   this.APNS.Volume,
+			}
+		} else {
+			aps.Sound = this.APNS.Name
+			aps.CriticalSound = nil
+		}
+	}
+}
+
+// validate checks the sound files and the critical sound volume
+func (this *SoundConfig) validate(v *validator, path string) {
+	if this.Android != nil && this.Android.Sound != default_sound &&
+		!androidSoundPattern.MatchString(this.Android.Sound) {
+		v.add(path+".android.sound", "must be %q or a res/raw resource name (a-z, 0-9, _) with an optional .mp3, .ogg or .wav extension, got %q", default_sound, this.Android.Sound)
+	}
+
+	if this.APNS != nil {
+		name := this.APNS.Name
+		if name != default_sound && !apnsSoundExtensions[strings.ToLower(filepath.Ext(name))] {
+			v.add(path+".apns.name", "must be %q or an .aiff, .wav or .caf file, got %q", default_sound, name)
+		}
+
+		if this.APNS.Critical && (this.APNS.Volume < 0 || this.APNS.Volume > 1) {
+			v.add(path+".apns.volume", "must be between 0 and 1, got %v", this.APNS.Volume)
+		}
+		if !this.APNS.Critical && this.APNS.Volume != 0 {
+			v.add(path+".apns.volume", "only critical sounds have a volume")
+		}
+	}
+}
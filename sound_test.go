@@ -0,0 +1,73 @@
+package fcm
+
+import (
+	"errors"
+	"testing"
+
+	messaging "firebase.google.com/go/v4/messaging"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSound_PerPlatform(t *testing.T) {
+	c := NewFcmClient("key").
+		NewFcmRegIdsMsg([]string{"token0"}, nil).
+		SetNotificationPayload(&NotificationPayload{Title: "title", Sound: "legacy.caf"}).
+		SetAndroidSound("catch_alert", "catches").
+		SetAPNSSound("catch_alert.caf")
+	require.Nil(t, c.Validate())
+
+	message, err := c.Message.makeMulticastMessage()
+	require.Nil(t, err)
+	require.Equal(t, "catch_alert", message.Android.Notification.Sound)
+	require.Equal(t, "catches", message.Android.Notification.ChannelID)
+	require.False(t, message.Android.Notification.DefaultSound)
+	require.Equal(t, "catch_alert.caf", message.APNS.Payload.Aps.Sound)
+	require.Nil(t, message.APNS.Payload.Aps.CriticalSound)
+}
+
+func TestSound_CriticalNeedsOptIn(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.MatchedBy(func(message *messaging.MulticastMessage) bool {
+		aps := message.APNS.Payload.Aps
+		return aps.Sound == "" && aps.CriticalSound.Critical && aps.CriticalSound.Name == "storm.caf" && aps.CriticalSound.Volume == 0.8
+	})).Return(successBatchResponse(), nil).Once()
+
+	c := NewFcmClient("key").
+		SetMessagingClient(messagingClientMock).
+		NewFcmRegIdsMsg([]string{"token0"}, nil).
+		SetNotificationPayload(&NotificationPayload{Title: "Storm warning"}).
+		SetCriticalSound("storm.caf", 0.8)
+
+	_, err := c.Send()
+	require.True(t, errors.Is(err, ErrCriticalAlertsDisabled))
+	require.Equal(t, []string{"sound.apns.critical"}, validationFields(t, c.Validate()))
+
+	_, err = c.SendToTopics([]string{"storms"})
+	require.True(t, errors.Is(err, ErrCriticalAlertsDisabled))
+
+	status, err := c.EnableCriticalAlerts(true).Send()
+	require.Nil(t, err)
+	require.True(t, status.Ok)
+	messagingClientMock.AssertExpectations(t)
+}
+
+func TestSound_Validate(t *testing.T) {
+	msg := FcmMsg{
+		RegistrationIds: []string{"token0"},
+		Sound: &SoundConfig{
+			Android: &AndroidSound{Sound: "Storm-Alert.m4a"},
+			APNS:    &APNSSound{Name: "storm.mp3", Critical: true, Volume: 1.5},
+		},
+	}
+	require.Equal(t, []string{"sound.android.sound", "sound.apns.name", "sound.apns.volume"}, validationFields(t, msg.Validate()))
+
+	msg.Sound = &SoundConfig{
+		Android: &AndroidSound{Sound: "default"},
+		APNS:    &APNSSound{Name: "default", Volume: 0.5},
+	}
+	require.Equal(t, []string{"sound.apns.volume"}, validationFields(t, msg.Validate()))
+
+	msg.Sound.APNS.Volume = 0
+	require.Nil(t, msg.Validate())
+}
@@ -0,0 +1,262 @@
+package fcm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// ErrTemplateNotFound returned for templates missing from the registry
+var ErrTemplateNotFound = errors.New("fcm: template not found")
+
+// NotificationTemplate text/template sources of a notification, executed
+// with the recipient variables, e.g. "{{.actor_nickname}} liked your catch"
+type NotificationTemplate struct {
+	Title string
+	Body  string
+	Image string
+	// Data values of the data payload keys
+	Data map[string]string
+}
+
+// RenderedNotification a template executed for a recipient
+type RenderedNotification struct {
+	Title string            `json:"title,omitempty"`
+	Body  string            `json:"body,omitempty"`
+	Image string            `json:"image,omitempty"`
+	Data  map[string]string `json:"data,omitempty"`
+}
+
+// compiledTemplate the parsed fields of a NotificationTemplate
+type compiledTemplate struct {
+	title *template.Template
+	body  *template.Template
+	image *template.Template
+	data  map[string]*template.Template
+}
+
+// TemplateRegistry notification templates by id, safe for concurrent use
+type TemplateRegistry struct {
+	lock      sync.RWMutex
+	templates map[string]*compiledTemplate
+}
+
+// NewTemplateRegistry creates an empty registry
+func NewTemplateRegistry() *TemplateRegistry {
+	return &TemplateRegistry{templates: make(map[string]*compiledTemplate)}
+}
+
+// Register parses the template and stores it under id, replacing any
+// template with the same id. Variables missing when rendering are errors.
+func (this *TemplateRegistry) Register(id string, source NotificationTemplate) error {
+	compiled := &compiledTemplate{data: make(map[string]*template.Template)}
+
+	var err error
+	if compiled.title, err = parseTemplateField(id, "title", source.Title); err != nil {
+		return err
+	}
+	if compiled.body, err = parseTemplateField(id, "body", source.Body); err != nil {
+		return err
+	}
+	if compiled.image, err = parseTemplateField(id, "image", source.Image); err != nil {
+		return err
+	}
+	for key, value := range source.Data {
+		if compiled.data[key], err = parseTemplateField(id, "data."+key, value); err != nil {
+			return err
+		}
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.templates[id] = compiled
+
+	return nil
+}
+
+// Render executes the template id with the recipient variables
+func (this *TemplateRegistry) Render(id string, vars map[string]interface{}) (*RenderedNotification, error) {
+	this.lock.RLock()
+	compiled, ok := this.templates[id]
+	this.lock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrTemplateNotFound, id)
+	}
+
+	rendered := &RenderedNotification{}
+
+	var err error
+	if rendered.Title, err = executeTemplateField(compiled.title, vars); err != nil {
+		return nil, err
+	}
+	if rendered.Body, err = executeTemplateField(compiled.body, vars); err != nil {
+		return nil, err
+	}
+	if rendered.Image, err = executeTemplateField(compiled.image, vars); err != nil {
+		return nil, err
+	}
+	if len(compiled.data) > 0 {
+		rendered.Data = make(map[string]string, len(compiled.data))
+		for key, tmpl := range compiled.data {
+			if rendered.Data[key], err = executeTemplateField(tmpl, vars); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return rendered, nil
+}
+
+// parseTemplateField parses a template field, nil when it is empty
+func parseTemplateField(id string, field string, source string) (*template.Template, error) {
+	if source == "" {
+		return nil, nil
+	}
+
+	tmpl, err := template.New(id + "." + field).Option("missingkey=error").Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("fcm: parsing template %s: %w", id, err)
+	}
+
+	return tmpl, nil
+}
+
+// executeTemplateField renders a template field, empty for nil templates
+func executeTemplateField(tmpl *template.Template, vars map[string]interface{}) (string, error) {
+	if tmpl == nil {
+		return "", nil
+	}
+
+	var result strings.Builder
+	if err := tmpl.Execute(&result, vars); err != nil {
+		return "", fmt.Errorf("fcm: rendering template: %w", err)
+	}
+
+	return result.String(), nil
+}
+
+// TemplateRecipient a token and the variables its notification is rendered with
+type TemplateRecipient struct {
+	Token string
+	Vars  map[string]interface{}
+}
+
+// TemplateGroupResult the outcome of the multicast to recipients sharing
+// the same rendering
+type TemplateGroupResult struct {
+	Rendered *RenderedNotification
+	Tokens   []string
+	Status   *FcmResponseStatus
+	Err      error
+}
+
+// TemplateSendResult the outcome of SendTemplate
+type TemplateSendResult struct {
+	Groups []*TemplateGroupResult
+	// RenderErrors recipients not sent to, by token, because their
+	// notification couldn't be rendered
+	RenderErrors map[string]error
+	Success      int
+	Fail         int
+}
+
+// SetTemplateRegistry sets the registry SendTemplate renders from
+func (this *FcmClient) SetTemplateRegistry(templates *TemplateRegistry) *FcmClient {
+	this.Templates = templates
+
+	return this
+}
+
+// SendTemplate renders the template id for every recipient and sends the
+// renderings, one multicast per distinct rendering. The rendered title,
+// body and image, when not empty, replace the ones of the message
+// notification, the rendered data values are added to the message data.
+func (this *FcmClient) SendTemplate(id string, recipients []TemplateRecipient) (*TemplateSendResult, error) {
+	if this.Templates == nil {
+		return nil, errors.New("fcm: no template registry, see SetTemplateRegistry")
+	}
+
+	result := &TemplateSendResult{RenderErrors: make(map[string]error)}
+	byRendering := make(map[string]*TemplateGroupResult)
+	for _, recipient := range recipients {
+		rendered, err := this.Templates.Render(id, recipient.Vars)
+		if errors.Is(err, ErrTemplateNotFound) {
+			return nil, err
+		}
+		if err != nil {
+			result.RenderErrors[recipient.Token] = err
+			result.Fail++
+			continue
+		}
+
+		// json sorts the data keys, so equal renderings share a key
+		key, err := json.Marshal(rendered)
+		if err != nil {
+			return nil, err
+		}
+
+		group, ok := byRendering[string(key)]
+		if !ok || len(group.Tokens) == max_send_each_messages {
+			group = &TemplateGroupResult{Rendered: rendered}
+			byRendering[string(key)] = group
+			result.Groups = append(result.Groups, group)
+		}
+		group.Tokens = append(group.Tokens, recipient.Token)
+	}
+
+	for _, group := range result.Groups {
+		group.Status, group.Err = this.withMessage(this.Message.withRendering(group.Rendered, group.Tokens)).Send()
+
+		switch {
+		case group.Err != nil:
+			result.Fail += len(group.Tokens)
+		default:
+			result.Success += group.Status.Success + group.Status.Duplicates
+			result.Fail += group.Status.Fail
+		}
+	}
+
+	return result, nil
+}
+
+// withRendering a copy of the message sending the rendering to the tokens
+func (this FcmMsg) withRendering(rendered *RenderedNotification, tokens []string) FcmMsg {
+	this.To = ""
+	this.Condition = ""
+	this.RegistrationIds = tokens
+
+	// a data-only template stays data-only, without an empty notification
+	if this.Notification != nil || rendered.Title != "" || rendered.Body != "" || rendered.Image != "" {
+		notification := &NotificationPayload{}
+		if this.Notification != nil {
+			*notification = *this.Notification
+		}
+		if rendered.Title != "" {
+			notification.Title = rendered.Title
+		}
+		if rendered.Body != "" {
+			notification.Body = rendered.Body
+		}
+		if rendered.Image != "" {
+			notification.Image = rendered.Image
+		}
+		this.Notification = notification
+	}
+
+	// the rendered values are sent as they are, added to the data payload
+	// as it would be sent; invalid data is left for Send to report
+	if len(rendered.Data) > 0 {
+		if current, ok := this.makeMulticastMessageData(); ok {
+			data := *current
+			for key, value := range rendered.Data {
+				data[key] = value
+			}
+			this.Data = data
+		}
+	}
+
+	return this
+}
@@ -0,0 +1,141 @@
+package fcm
+
+import (
+	"errors"
+	"testing"
+
+	messaging "firebase.google.com/go/v4/messaging"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func testTemplates(t *testing.T) *TemplateRegistry {
+	templates := NewTemplateRegistry()
+	require.Nil(t, templates.Register("catch_liked", NotificationTemplate{
+		Title: "New like",
+		Body:  "{{.actor_nickname}} liked your catch",
+		Image: "https://example.com/catches/{{.catch_id}}.jpg",
+		Data:  map[string]string{"item_id": "{{.catch_id}}"},
+	}))
+
+	return templates
+}
+
+func TestTemplateRegistry_Render(t *testing.T) {
+	templates := testTemplates(t)
+
+	rendered, err := templates.Render("catch_liked", map[string]interface{}{"actor_nickname": "Anna", "catch_id": 42})
+	require.Nil(t, err)
+	require.Equal(t, &RenderedNotification{
+		Title: "New like",
+		Body:  "Anna liked your catch",
+		Image: "https://example.com/catches/42.jpg",
+		Data:  map[string]string{"item_id": "42"},
+	}, rendered)
+
+	_, err = templates.Render("catch_liked", map[string]interface{}{"actor_nickname": "Anna"})
+	require.NotNil(t, err)
+
+	_, err = templates.Render("unknown", nil)
+	require.True(t, errors.Is(err, ErrTemplateNotFound))
+
+	require.NotNil(t, templates.Register("broken", NotificationTemplate{Body: "{{.actor_nickname"}))
+}
+
+func TestSendTemplate_GroupsIdenticalRenderings(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.MatchedBy(func(message *messaging.MulticastMessage) bool {
+		return message.Notification.Body == "Anna liked your catch" &&
+			message.Data["item_id"] == "42" &&
+			message.Data["item_type"] == "catch" &&
+			len(message.Tokens) == 2
+	})).Return(&messaging.BatchResponse{
+		SuccessCount: 2,
+		Responses:    []*messaging.SendResponse{{Success: true}, {Success: true}},
+	}, nil).Once()
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.MatchedBy(func(message *messaging.MulticastMessage) bool {
+		return message.Notification.Body == "Erik liked your catch" &&
+			message.Tokens[0] == "token2"
+	})).Return(successBatchResponse(), nil).Once()
+
+	c := NewFcmClient("key").
+		SetMessagingClient(messagingClientMock).
+		SetTemplateRegistry(testTemplates(t)).
+		SetMsgData(map[string]interface{}{"item_type": "catch"})
+
+	result, err := c.SendTemplate("catch_liked", []TemplateRecipient{
+		{Token: "token0", Vars: map[string]interface{}{"actor_nickname": "Anna", "catch_id": "42"}},
+		{Token: "token1", Vars: map[string]interface{}{"actor_nickname": "Anna", "catch_id": "42"}},
+		{Token: "token2", Vars: map[string]interface{}{"actor_nickname": "Erik", "catch_id": "42"}},
+		{Token: "token3", Vars: map[string]interface{}{"catch_id": "42"}},
+	})
+	require.Nil(t, err)
+	messagingClientMock.AssertExpectations(t)
+
+	require.Len(t, result.Groups, 2)
+	require.Equal(t, []string{"token0", "token1"}, result.Groups[0].Tokens)
+	require.Equal(t, 3, result.Success)
+	require.Equal(t, 1, result.Fail)
+	require.Contains(t, result.RenderErrors, "token3")
+
+	_, err = c.SendTemplate("unknown", []TemplateRecipient{{Token: "token0"}})
+	require.True(t, errors.Is(err, ErrTemplateNotFound))
+}
+
+func TestSendTemplate_CustomData(t *testing.T) {
+	templates := NewTemplateRegistry()
+	require.Nil(t, templates.Register("promo", NotificationTemplate{
+		Body: "{{.offer}}",
+		Data: map[string]string{
+			"campaign_id": "{{.campaign}}",
+			"actions":     `[{"type":"open","value":"{{.campaign}}"}]`,
+		},
+	}))
+
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.MatchedBy(func(message *messaging.MulticastMessage) bool {
+		return message.Notification.Title == "Fishbrain" &&
+			message.Notification.Body == "50% off" &&
+			message.Data["campaign_id"] == "spring" &&
+			message.Data["actions"] == `[{"type":"open","value":"spring"}]` &&
+			message.Data["item_type"] == "promo"
+	})).Return(successBatchResponse(), nil).Once()
+
+	c := NewFcmClient("key").
+		SetMessagingClient(messagingClientMock).
+		SetTemplateRegistry(templates).
+		SetNotificationPayload(&NotificationPayload{Title: "Fishbrain", Body: "Fallback"}).
+		SetMsgData(map[string]interface{}{"item_type": "promo"})
+
+	result, err := c.SendTemplate("promo", []TemplateRecipient{
+		{Token: "token0", Vars: map[string]interface{}{"offer": "50% off", "campaign": "spring"}},
+	})
+	require.Nil(t, err)
+	require.Equal(t, 1, result.Success)
+	messagingClientMock.AssertExpectations(t)
+}
+
+func TestSendTemplate_DataOnly(t *testing.T) {
+	templates := NewTemplateRegistry()
+	require.Nil(t, templates.Register("sync", NotificationTemplate{
+		Data: map[string]string{"catch_id": "{{.catch}}"},
+	}))
+
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.MatchedBy(func(message *messaging.MulticastMessage) bool {
+		return message.Notification == nil &&
+			(message.Android == nil || message.Android.Notification == nil) &&
+			message.Data["catch_id"] == "42"
+	})).Return(successBatchResponse(), nil).Once()
+
+	c := NewFcmClient("key").
+		SetMessagingClient(messagingClientMock).
+		SetTemplateRegistry(templates)
+
+	result, err := c.SendTemplate("sync", []TemplateRecipient{
+		{Token: "token0", Vars: map[string]interface{}{"catch": "42"}},
+	})
+	require.Nil(t, err)
+	require.Equal(t, 1, result.Success)
+	messagingClientMock.AssertExpectations(t)
+}
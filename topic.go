@@ -0,0 +1,84 @@
+package fcm
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// topicNamePattern characters FCM allows in topic names
+	topicNamePattern = regexp.MustCompile("^[a-zA-Z0-9-_.~%]+$")
+)
+
+// Topic a valid FCM topic name, without the /topics/ prefix
+type Topic string
+
+// InvalidTopicError returned for topic names FCM doesn't accept
+type InvalidTopicError struct {
+	Topic  string
+	Reason string
+}
+
+// Error describes the invalid topic name
+func (this *InvalidTopicError) Error() string {
+	return fmt.Sprintf("fcm: invalid topic %q: %s", this.Topic, this.Reason)
+}
+
+// ParseTopic validates a topic name, with or without the /topics/ prefix
+// (case insensitive). Names must match [a-zA-Z0-9-_.~%]+
+func ParseTopic(topic string) (Topic, error) {
+	name := extractTopicName(topic)
+
+	if name == "" {
+		return "", &InvalidTopicError{Topic: topic, Reason: "empty topic name"}
+	}
+
+	if !topicNamePattern.MatchString(name) {
+		invalid := strings.TrimLeft(name, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_.~%")
+		return "", &InvalidTopicError{
+			Topic:  topic,
+			Reason: fmt.Sprintf("character %q is not allowed, names must match [a-zA-Z0-9-_.~%%]+", []rune(invalid)[0]),
+		}
+	}
+
+	return Topic(name), nil
+}
+
+// Name the topic name, without the /topics/ prefix
+func (this Topic) Name() string {
+	return string(this)
+}
+
+// Path the topic with the /topics/ prefix, as used in message targets
+func (this Topic) Path() string {
+	return topics + string(this)
+}
+
+// String the topic name
+func (this Topic) String() string {
+	return string(this)
+}
+
+// isTopicTarget whether a message target refers to a topic
+func isTopicTarget(to string) bool {
+	return len(to) >= len(topics) && strings.EqualFold(to[:len(topics)], topics)
+}
+
+// topicError the *InvalidTopicError of a topic target, nil for other targets
+func (this *FcmMsg) topicError() error {
+	if !isTopicTarget(this.To) {
+		return nil
+	}
+
+	_, err := ParseTopic(this.To)
+	return err
+}
+
+// NewFcmMsgToTopic sets the targeted topic and the data payload
+func (this *FcmClient) NewFcmMsgToTopic(topic Topic, body interface{}) *FcmClient {
+	this.Message.To = topic.Path()
+	this.Message.Data = body
+
+	return this
+}
@@ -0,0 +1,80 @@
+package fcm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTopic(t *testing.T) {
+	topic, err := ParseTopic("/TOPICS/news-1.en_US~%20")
+	require.Nil(t, err)
+	require.Equal(t, "news-1.en_US~%20", topic.Name())
+	require.Equal(t, "/topics/news-1.en_US~%20", topic.Path())
+
+	topic, err = ParseTopic("news")
+	require.Nil(t, err)
+	require.Equal(t, Topic("news"), topic)
+
+	for _, invalid := range []string{"", "/topics/", "bad topic", "/topics/a/b", "news/topics/sport", "café"} {
+		_, err := ParseTopic(invalid)
+
+		var topicErr *InvalidTopicError
+		require.True(t, errors.As(err, &topicErr), invalid)
+		require.Equal(t, invalid, topicErr.Topic)
+	}
+}
+
+func TestNewFcmMsgTo_NormalisesTopic(t *testing.T) {
+	c := NewFcmClient("key").NewFcmMsgTo("/Topics/news", nil)
+	require.Equal(t, "/topics/news", c.Message.To)
+
+	c.NewFcmMsgToTopic(Topic("sport"), nil)
+	require.Equal(t, "/topics/sport", c.Message.To)
+
+	// device tokens are left untouched
+	c.NewFcmMsgTo("token0", nil)
+	require.Equal(t, "token0", c.Message.To)
+}
+
+func TestValidate_InvalidTopic(t *testing.T) {
+	msg := FcmMsg{To: "/topics/bad topic"}
+
+	err := msg.Validate()
+	require.Equal(t, []string{"to"}, validationFields(t, err))
+
+	var topicErr *InvalidTopicError
+	require.True(t, errors.As(err, &topicErr))
+}
+
+func TestTopicApis_RejectInvalidTopic(t *testing.T) {
+	c := NewFcmClient("key")
+
+	var topicErr *InvalidTopicError
+	_, err := c.SubscribeToTopic("token0", "bad topic")
+	require.True(t, errors.As(err, &topicErr))
+
+	_, err = c.BatchSubscribeToTopic([]string{"token0"}, "/topics/a/b")
+	require.True(t, errors.As(err, &topicErr))
+
+	_, err = c.BatchUnsubscribeFromTopic([]string{"token0"}, "")
+	require.True(t, errors.As(err, &topicErr))
+
+	_, err = c.SendToTopics([]string{"news", "bad topic"})
+	require.True(t, errors.As(err, &topicErr))
+}
+
+func TestSend_InvalidTopic(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	c := NewFcmClient("key").SetMessagingClient(messagingClientMock).NewFcmMsgTo("/topics/a/b", nil)
+
+	var topicErr *InvalidTopicError
+	_, err := c.Send()
+	require.True(t, errors.As(err, &topicErr))
+	require.Equal(t, "/topics/a/b", topicErr.Topic)
+
+	require.True(t, errors.As(c.Validate(), &topicErr))
+	messagingClientMock.AssertNotCalled(t, "SendEachForMulticast", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,188 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+
+	messaging "firebase.google.com/go/v4/messaging"
+)
+
+const (
+	// max_send_each_messages the maximum number of messages of a SendEach call
+	max_send_each_messages = 500
+	// apns_collapse_id_header APNs header replacing displayed notifications with the same id
+	apns_collapse_id_header = "apns-collapse-id"
+	// topics_collapse_key_prefix prefix of the generated collapse keys
+	topics_collapse_key_prefix = "topics-"
+)
+
+// TopicGroupResult the outcome of the condition send to a group of topics
+type TopicGroupResult struct {
+	Topics    []string
+	Condition string
+	MessageID string
+	Err       error
+}
+
+// TopicsSendResult the outcome of SendToTopics
+type TopicsSendResult struct {
+	Groups []*TopicGroupResult
+	// CollapseKey shared by every group message
+	CollapseKey string
+	Success     int
+	Fail        int
+}
+
+// SendToTopics sends the message to the devices subscribed to any of the
+// topics. FCM conditions allow at most MAX_CONDITION_TOPICS topics, so the
+// topics are ORed into the minimum number of conditions and one message is
+// sent per group.
+//
+// A device subscribed to topics of different groups receives a message per
+// group. To avoid showing duplicates every group message carries the same
+// collapse key (the message CollapseKey, or a generated "topics-" one): it
+// is set as the Android collapse key and notification tag, and as the APNs
+// collapse id, so a later copy replaces the displayed notification. Data-only
+// messages are still delivered once per group and should be deduplicated by
+// the app, e.g. using an item id from the data.
+func (this *FcmClient) SendToTopics(topics []string) (*TopicsSendResult, error) {
+	ctx, span := this.startSpan(context.Background(), span_send_topics, attr_topics.Int(len(topics)))
+	result, err := this.sendToTopics(ctx, topics)
+	err = this.redactor().Error(err)
+	if result != nil {
+		for _, group := range result.Groups {
+			group.Err = this.redactor().Error(group.Err)
+		}
+		endSpan(span, err, attr_success.Int(result.Success), attr_failure.Int(result.Fail))
+	} else {
+		endSpan(span, err)
+	}
+
+	return result, err
+}
+
+// sendToTopics sends the topic group messages within the span of ctx
+func (this *FcmClient) sendToTopics(ctx context.Context, topics []string) (*TopicsSendResult, error) {
+	if err := this.checkCriticalAlerts(&this.Message); err != nil {
+		return nil, err
+	}
+
+	groups, err := groupConditionTopics(topics)
+	if err != nil {
+		return nil, err
+	}
+
+	template, err := this.Message.makeMulticastMessage()
+	if err != nil {
+		return nil, err
+	}
+	if err := this.Message.fitPayload(template); err != nil {
+		return nil, err
+	}
+
+	collapseKey := this.Message.CollapseKey
+	if collapseKey == "" {
+		collapseKey = topics_collapse_key_prefix + newEntryID()[:16]
+	}
+	setCollapseKey(template, collapseKey)
+
+	result := &TopicsSendResult{CollapseKey: collapseKey}
+	messages := make([]*messaging.Message, 0, len(groups))
+	for _, group := range groups {
+		message := toMessage(template)
+		message.Condition = group.String()
+		messages = append(messages, message)
+
+		result.Groups = append(result.Groups, &TopicGroupResult{
+			Topics:    group.Topics(),
+			Condition: message.Condition,
+		})
+	}
+
+	client, err := this.batchMessagingClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for start := 0; start < len(messages); start += max_send_each_messages {
+		end := start + max_send_each_messages
+		if end > len(messages) {
+			end = len(messages)
+		}
+
+		batchResponse, err := client.SendEach(ctx, messages[start:end])
+		for i, group := range result.Groups[start:end] {
+			switch {
+			case err != nil:
+				group.Err = err
+			case i < len(batchResponse.Responses):
+				group.MessageID = batchResponse.Responses[i].MessageID
+				group.Err = batchResponse.Responses[i].Error
+			}
+
+			if group.Err != nil {
+				result.Fail++
+			} else {
+				result.Success++
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// groupConditionTopics splits the distinct topics into the minimum number
+// of OR conditions within the FCM limits
+func groupConditionTopics(topics []string) ([]*ConditionExpr, error) {
+	var names []string
+	seen := make(map[string]bool)
+	for _, topic := range topics {
+		parsed, err := ParseTopic(topic)
+		if err != nil {
+			return nil, err
+		}
+		if name := parsed.Name(); !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	if len(names) == 0 {
+		return nil, errors.New("fcm: no topics to send to")
+	}
+
+	var groups []*ConditionExpr
+	for start := 0; start < len(names); start += MAX_CONDITION_TOPICS {
+		end := start + MAX_CONDITION_TOPICS
+		if end > len(names) {
+			end = len(names)
+		}
+
+		group := InTopic(names[start])
+		for _, name := range names[start+1 : end] {
+			group = group.Or(InTopic(name))
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, nil
+}
+
+// setCollapseKey tags the message so devices collapse copies of it
+func setCollapseKey(message *messaging.MulticastMessage, collapseKey string) {
+	if message.Android == nil {
+		message.Android = &messaging.AndroidConfig{}
+	}
+	message.Android.CollapseKey = collapseKey
+	if message.Notification != nil {
+		ensureAndroidNotification(message).Tag = collapseKey
+	}
+
+	if message.APNS == nil {
+		message.APNS = &messaging.APNSConfig{}
+	}
+	if message.APNS.Headers == nil {
+		message.APNS.Headers = make(map[string]string)
+	}
+	message.APNS.Headers[apns_collapse_id_header] = collapseKey
+}
@@ -0,0 +1,94 @@
+package fcm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	messaging "firebase.google.com/go/v4/messaging"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupConditionTopics(t *testing.T) {
+	var topics []string
+	for i := 0; i < 12; i++ {
+		topics = append(topics, fmt.Sprintf("/topics/lake-%d", i))
+	}
+	// duplicates are sent once
+	topics = append(topics, "lake-0")
+
+	groups, err := groupConditionTopics(topics)
+	require.Nil(t, err)
+	require.Len(t, groups, 3)
+	require.Equal(t, "'lake-0' in topics || 'lake-1' in topics || 'lake-2' in topics || 'lake-3' in topics || 'lake-4' in topics", groups[0].String())
+	require.Equal(t, []string{"lake-10", "lake-11"}, groups[2].Topics())
+
+	_, err = groupConditionTopics(nil)
+	require.NotNil(t, err)
+
+	_, err = groupConditionTopics([]string{"bad topic"})
+	require.NotNil(t, err)
+}
+
+func TestSendToTopics(t *testing.T) {
+	var topics []string
+	for i := 0; i < 7; i++ {
+		topics = append(topics, fmt.Sprintf("lake-%d", i))
+	}
+
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEach", mock.Anything, mock.MatchedBy(func(messages []*messaging.Message) bool {
+		if len(messages) != 2 {
+			return false
+		}
+		for _, message := range messages {
+			if message.Android.CollapseKey != "catch-42" ||
+				message.Android.Notification.Tag != "catch-42" ||
+				message.APNS.Headers["apns-collapse-id"] != "catch-42" ||
+				message.Data["item_id"] != "42" {
+				return false
+			}
+		}
+		return messages[1].Condition == "'lake-5' in topics || 'lake-6' in topics"
+	})).Return(&messaging.BatchResponse{
+		SuccessCount: 1,
+		FailureCount: 1,
+		Responses: []*messaging.SendResponse{
+			{Success: true, MessageID: "1"},
+			{Success: false, Error: errors.New("quota exceeded")},
+		},
+	}, nil)
+
+	c := NewFcmClient("key").
+		SetMessagingClient(messagingClientMock).
+		SetMsgData(map[string]interface{}{"item_id": "42"}).
+		SetCollapseKey("catch-42").
+		SetNotificationPayload(&NotificationPayload{Title: "title", Body: "body"})
+
+	result, err := c.SendToTopics(topics)
+	require.Nil(t, err)
+	messagingClientMock.AssertExpectations(t)
+
+	require.Equal(t, "catch-42", result.CollapseKey)
+	require.Equal(t, 1, result.Success)
+	require.Equal(t, 1, result.Fail)
+	require.Len(t, result.Groups, 2)
+	require.Equal(t, "1", result.Groups[0].MessageID)
+	require.Len(t, result.Groups[0].Topics, 5)
+	require.Nil(t, result.Groups[0].Err)
+	require.Equal(t, []string{"lake-5", "lake-6"}, result.Groups[1].Topics)
+	require.NotNil(t, result.Groups[1].Err)
+}
+
+func TestSendToTopics_GeneratesCollapseKey(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEach", mock.Anything, mock.Anything).Return(successBatchResponse(), nil)
+
+	c := NewFcmClient("key").SetMessagingClient(messagingClientMock)
+
+	result, err := c.SendToTopics([]string{"news"})
+	require.Nil(t, err)
+	require.Regexp(t, "^topics-[0-9a-f]{16}$", result.CollapseKey)
+	require.Equal(t, 1, result.Success)
+}
@@ -0,0 +1,160 @@
+package fcm
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+
+	messaging "firebase.google.com/go/v4/messaging"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const (
+	// tracer_name the instrumentation scope of the spans
+	tracer_name = "github.com/fishbrain/go-fcm"
+
+	// span names of the sends, and of the FCM calls of their chunks
+	span_send            = "fcm.Send"
+	span_send_each       = "fcm.SendEach"
+	span_send_topics     = "fcm.SendToTopics"
+	span_authorize       = "fcm.authorize"
+	span_deliver         = "fcm.Dispatcher.deliver"
+	span_multicast_chunk = "fcm.multicast"
+	span_send_each_chunk = "fcm.send_each"
+
+	// attribute keys, spans only carry counts and never the tokens
+	attr_tokens      = attribute.Key("fcm.tokens")
+	attr_messages    = attribute.Key("fcm.messages")
+	attr_topics      = attribute.Key("fcm.topics")
+	attr_success     = attribute.Key("fcm.success")
+	attr_failure     = attribute.Key("fcm.failure")
+	attr_duplicates  = attribute.Key("fcm.duplicates")
+	attr_error_codes = attribute.Key("fcm.error_codes")
+	attr_attempt     = attribute.Key("fcm.attempt")
+	attr_credentials = attribute.Key("fcm.credentials")
+
+	// credentials_key names of the credentials authorizing a messaging client
+	credentials_key      = "key"
+	credentials_embedded = "embedded"
+	credentials_id_pool  = "id_pool"
+)
+
+// SetTracerProvider sets the provider of the OpenTelemetry tracer
+// recording spans of the sends, their FCM calls and the retries
+func (this *FcmClient) SetTracerProvider(provider trace.TracerProvider) *FcmClient {
+	this.TracerProvider = provider
+
+	return this
+}
+
+// tracer the tracer of the client, a no-op one when no provider is set
+func (this *FcmClient) tracer() trace.Tracer {
+	if this.TracerProvider == nil {
+		return noop.NewTracerProvider().Tracer(tracer_name)
+	}
+
+	return this.TracerProvider.Tracer(tracer_name)
+}
+
+// startSpan starts a span of the client tracer
+func (this *FcmClient) startSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return this.tracer().Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// endSpan ends span, recording err
+func endSpan(span trace.Span, err error, attributes ...attribute.KeyValue) {
+	span.SetAttributes(attributes...)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// statusAttributes the outcome of a send
+func statusAttributes(status *FcmResponseStatus) []attribute.KeyValue {
+	if status == nil {
+		return nil
+	}
+
+	return []attribute.KeyValue{
+		attr_success.Int(status.Success),
+		attr_failure.Int(status.Fail),
+		attr_duplicates.Int(status.Duplicates),
+	}
+}
+
+// authorize creates a Firebase messaging client within a span, credentials
+// names the credentials used
+func (this *FcmClient) authorize(ctx context.Context, credentials string, authorize func(*slog.Logger) (*messaging.Client, error)) (*messaging.Client, error) {
+	_, span := this.startSpan(ctx, span_authorize, attr_credentials.String(credentials))
+	client, err := authorize(this.logger().With("credentials", credentials))
+	err = this.redactor().Error(err)
+	endSpan(span, err)
+
+	return client, err
+}
+
+// tracedClient a MessagingClient recording a span per call
+type tracedClient struct {
+	client   MessagingClient
+	tracer   trace.Tracer
+	redactor *Redactor
+}
+
+func (this *tracedClient) SendEachForMulticast(ctx context.Context, message *messaging.MulticastMessage) (*messaging.BatchResponse, error) {
+	ctx, span := this.tracer.Start(ctx, span_multicast_chunk, trace.WithAttributes(attr_tokens.Int(len(message.Tokens))))
+	response, err := this.client.SendEachForMulticast(ctx, message)
+	endSpan(span, this.redactor.Error(err, message.Tokens...), responseAttributes(response, err)...)
+
+	return response, err
+}
+
+func (this *tracedClient) SendEach(ctx context.Context, messages []*messaging.Message) (*messaging.BatchResponse, error) {
+	ctx, span := this.tracer.Start(ctx, span_send_each_chunk, trace.WithAttributes(attr_messages.Int(len(messages))))
+	response, err := sendEachWith(ctx, this.client, messages)
+	tokens := make([]string, 0, len(messages))
+	for _, message := range messages {
+		tokens = append(tokens, message.Token)
+	}
+	endSpan(span, this.redactor.Error(err, tokens...), responseAttributes(response, err)...)
+
+	return response, err
+}
+
+// responseAttributes the success and failure counts of a call, and the
+// distinct error codes of its failures
+func responseAttributes(response *messaging.BatchResponse, err error) []attribute.KeyValue {
+	if err != nil {
+		return []attribute.KeyValue{attr_error_codes.StringSlice([]string{string(ErrorCodeOf(err))})}
+	}
+	if response == nil {
+		return nil
+	}
+
+	seen := make(map[ErrorCode]bool)
+	var errorCodes []string
+	for _, sendResponse := range response.Responses {
+		if sendResponse == nil || sendResponse.Success {
+			continue
+		}
+		if code := ErrorCodeOf(sendResponse.Error); !seen[code] {
+			seen[code] = true
+			errorCodes = append(errorCodes, string(code))
+		}
+	}
+	sort.Strings(errorCodes)
+
+	attributes := []attribute.KeyValue{
+		attr_success.Int(response.SuccessCount),
+		attr_failure.Int(response.FailureCount),
+	}
+	if len(errorCodes) > 0 {
+		attributes = append(attributes, attr_error_codes.StringSlice(errorCodes))
+	}
+
+	return attributes
+}
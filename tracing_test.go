@@ -0,0 +1,185 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	messaging "firebase.google.com/go/v4/messaging"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newRecordingTracerProvider() (*sdktrace.TracerProvider, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+
+	return sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)), recorder
+}
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attributes := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attributes[kv.Key] = kv.Value
+	}
+
+	return attributes
+}
+
+func spansNamed(spans []sdktrace.ReadOnlySpan, name string) []sdktrace.ReadOnlySpan {
+	var named []sdktrace.ReadOnlySpan
+	for _, span := range spans {
+		if span.Name() == name {
+			named = append(named, span)
+		}
+	}
+
+	return named
+}
+
+func TestTracing_Send(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.Anything).Return(&messaging.BatchResponse{
+		SuccessCount: 2,
+		FailureCount: 1,
+		Responses: []*messaging.SendResponse{
+			{Success: true, MessageID: "1"},
+			{Error: errors.New("bad token")},
+			{Success: true, MessageID: "2"},
+		},
+	}, nil).Once()
+
+	provider, recorder := newRecordingTracerProvider()
+	tokens := []string{"secret-token-0", "secret-token-1", "secret-token-2"}
+	c := NewFcmClient("key").
+		SetMessagingClient(messagingClientMock).
+		SetTracerProvider(provider).
+		NewFcmRegIdsMsg(tokens, nil)
+
+	_, err := c.Send()
+	require.Nil(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	send := spansNamed(spans, span_send)[0]
+	chunk := spansNamed(spans, span_multicast_chunk)[0]
+	require.Equal(t, send.SpanContext().SpanID(), chunk.Parent().SpanID())
+
+	attributes := spanAttributes(chunk)
+	require.Equal(t, int64(3), attributes[attr_tokens].AsInt64())
+	require.Equal(t, int64(2), attributes[attr_success].AsInt64())
+	require.Equal(t, int64(1), attributes[attr_failure].AsInt64())
+	require.Equal(t, []string{string(ErrorCode_UNKNOWN)}, attributes[attr_error_codes].AsStringSlice())
+
+	attributes = spanAttributes(send)
+	require.Equal(t, int64(3), attributes[attr_tokens].AsInt64())
+	require.Equal(t, int64(1), attributes[attr_failure].AsInt64())
+
+	for _, span := range spans {
+		for _, kv := range span.Attributes() {
+			require.False(t, strings.Contains(kv.Value.Emit(), "secret-token"), "span %s attribute %s", span.Name(), kv.Key)
+		}
+	}
+	messagingClientMock.AssertExpectations(t)
+}
+
+func TestTracing_Authorize(t *testing.T) {
+	authorize := authAndGetFcmClient
+	defer func() { authAndGetFcmClient = authorize }()
+	authAndGetFcmClient = func(*slog.Logger) (*messaging.Client, error) {
+		return nil, errors.New("no credentials")
+	}
+
+	provider, recorder := newRecordingTracerProvider()
+	c := NewFcmClient("key").
+		SetTracerProvider(provider).
+		NewFcmRegIdsMsg([]string{"token0"}, nil)
+
+	_, err := c.Send()
+	require.NotNil(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	send := spansNamed(spans, span_send)[0]
+	auth := spansNamed(spans, span_authorize)[0]
+	require.Equal(t, send.SpanContext().SpanID(), auth.Parent().SpanID())
+	require.Equal(t, credentials_key, spanAttributes(auth)[attr_credentials].AsString())
+	require.Equal(t, codes.Error, auth.Status().Code)
+	require.Equal(t, codes.Error, send.Status().Code)
+}
+
+func TestTracing_SendEachChunks(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEach", mock.Anything, mock.Anything).Return((*messaging.BatchResponse)(nil), errors.New("down"))
+
+	provider, recorder := newRecordingTracerProvider()
+	c := NewFcmClient("key").SetMessagingClient(messagingClientMock).SetTracerProvider(provider)
+
+	var recipients []RecipientMessage
+	for i := 0; i < max_send_each_messages+1; i++ {
+		recipients = append(recipients, RecipientMessage{
+			RecipientID: fmt.Sprintf("recipient%d", i),
+			Token:       "token",
+			Message:     FcmMsg{Notification: &NotificationPayload{Title: "title"}},
+		})
+	}
+	result, err := c.SendEach(recipients, SendEachOptions{})
+	require.Nil(t, err)
+	require.Equal(t, max_send_each_messages+1, result.Fail)
+
+	spans := recorder.Ended()
+	parent := spansNamed(spans, span_send_each)[0]
+	chunks := spansNamed(spans, span_send_each_chunk)
+	require.Len(t, chunks, 2)
+	for _, chunk := range chunks {
+		require.Equal(t, parent.SpanContext().SpanID(), chunk.Parent().SpanID())
+		require.Equal(t, codes.Error, chunk.Status().Code)
+	}
+	require.Equal(t, int64(max_send_each_messages+1), spanAttributes(parent)[attr_failure].AsInt64())
+}
+
+func TestTracing_DispatcherAttempts(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.Anything).Return((*messaging.BatchResponse)(nil), errors.New("down")).Once()
+	messagingClientMock.On("SendEachForMulticast", mock.Anything, mock.Anything).Return(successBatchResponse(), nil).Once()
+
+	provider, recorder := newRecordingTracerProvider()
+	c := NewFcmClient("key").SetMessagingClient(messagingClientMock).SetTracerProvider(provider)
+
+	done := make(chan struct{})
+	d := NewDispatcher(c, NewMemoryOutbox(), DispatcherOptions{
+		RetryBackoff: time.Millisecond,
+		PollInterval: time.Millisecond,
+		OnResult: func(entry *OutboxEntry, status *FcmResponseStatus, err error) {
+			close(done)
+		},
+	})
+	defer d.Close(context.Background())
+
+	_, err := d.Enqueue(FcmMsg{RegistrationIds: []string{"token0"}})
+	require.Nil(t, err)
+	<-done
+
+	attempts := spansNamed(recorder.Ended(), span_deliver)
+	require.Len(t, attempts, 2)
+	for i, attempt := range attempts {
+		require.Equal(t, int64(i+1), spanAttributes(attempt)[attr_attempt].AsInt64())
+
+		sends := 0
+		for _, send := range spansNamed(recorder.Ended(), span_send) {
+			if send.Parent().SpanID() == attempt.SpanContext().SpanID() {
+				sends++
+			}
+		}
+		require.Equal(t, 1, sends)
+	}
+	require.Equal(t, codes.Error, attempts[0].Status().Code)
+	require.Equal(t, codes.Unset, attempts[1].Status().Code)
+}
@@ -4,16 +4,35 @@ import (
 	"context"
 	_ "embed"
 	"encoding/json"
+	"log/slog"
 	"os"
 
 	firebase "firebase.google.com/go/v4"
 	"firebase.google.com/go/v4/messaging"
-	logging "github.com/fishbrain/logging-go"
 	"google.golang.org/api/option"
 )
 
 var firebaseNewApp = firebase.NewApp
 
+// DiscardHandler a slog.Handler dropping every record, used when no logger is set
+var DiscardHandler slog.Handler = discardHandler{}
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// loggerOrDiscard logger, or a logger dropping every record when nil
+func loggerOrDiscard(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return slog.New(DiscardHandler)
+	}
+
+	return logger
+}
+
 //go:embed workload_identity_pool_credentials_staging.json
 var gcpCredentialsStaging []byte
 
@@ -21,7 +40,14 @@ var gcpCredentialsStaging []byte
 var gcpCredentialsProduction []byte
 
 func AuthorizeAndGetFirebaseMessagingClient() (*messaging.Client, error) {
-	
+	return AuthorizeAndGetFirebaseMessagingClientWithLogger(nil)
+}
+
+// AuthorizeAndGetFirebaseMessagingClientWithLogger authorizes with the
+// workload identity pool credentials of BONITO_ENV, logging to logger
+func AuthorizeAndGetFirebaseMessagingClientWithLogger(logger *slog.Logger) (*messaging.Client, error) {
+	logger = loggerOrDiscard(logger)
+
 	environment := os.Getenv("BONITO_ENV")
 	
 	var gcpCredentials []byte
@@ -35,26 +61,31 @@ func AuthorizeAndGetFirebaseMessagingClient() (*messaging.Client, error) {
 	opts := []option.ClientOption{option.WithCredentialsJSON(gcpCredentials)}
 
 	projectId := os.Getenv("GCP_PROD_PROJECT_ID")
-	logging.Log.Infof("Initializing firebase app with project ID: %s", projectId)
+	logger.Debug("initializing firebase app", "project_id", projectId, "environment", environment)
 	firebaseApp, err := firebaseNewApp(context.Background(), &firebase.Config{ProjectID: projectId}, opts...)
 
 	if err != nil {
-		logging.Log.Errorf("Error initializing firebase app: %s", err)
+		logger.Error("error initializing firebase app", "error", err)
 		return nil, err
 	}
-	logging.Log.Infof("App: %s", firebaseApp)
 
 	fcmClient, err := firebaseApp.Messaging(context.Background())
 	if err != nil {
-		logging.Log.Errorf("Error initializing FCM client: %s", err)
+		logger.Error("error initializing FCM client", "error", err)
 		return nil, err
 	}
-	logging.Log.Infof("FCM Client: %v", fcmClient)
 
 	return fcmClient, err
 }
 
 func AuthorizeAndGetfcmClientFromKey() (*messaging.Client, error) {
+	return AuthorizeAndGetfcmClientFromKeyWithLogger(nil)
+}
+
+// AuthorizeAndGetfcmClientFromKeyWithLogger authorizes with the
+// FIREBASE_SERVICE_ACCOUNT_KEY service account, logging to logger
+func AuthorizeAndGetfcmClientFromKeyWithLogger(logger *slog.Logger) (*messaging.Client, error) {
+	logger = loggerOrDiscard(logger)
 
 	var secretString = os.Getenv("FIREBASE_SERVICE_ACCOUNT_KEY")
 
@@ -63,13 +94,13 @@ func AuthorizeAndGetfcmClientFromKey() (*messaging.Client, error) {
 	firebaseApp, err := firebaseNewApp(context.Background(), nil, opts...)
 
 	if err != nil {
-		logging.Log.Infof("Error initializing firebase app: %s", err)
+		logger.Error("error initializing firebase app", "error", err)
 		return nil, err
 	}
 
 	fcmClient, err := firebaseApp.Messaging(context.Background())
 	if err != nil {
-		logging.Log.Infof("Error initializing FCM client: %s", err)
+		logger.Error("error initializing FCM client", "error", err)
 		return nil, err
 	}
 
@@ -77,7 +108,14 @@ func AuthorizeAndGetfcmClientFromKey() (*messaging.Client, error) {
 }
 
 func AuthorizeAndGetfcmClientFromIdPoolKey() (*messaging.Client, error) {
-		
+	return AuthorizeAndGetfcmClientFromIdPoolKeyWithLogger(nil)
+}
+
+// AuthorizeAndGetfcmClientFromIdPoolKeyWithLogger authorizes with the
+// staging workload identity pool, logging to logger
+func AuthorizeAndGetfcmClientFromIdPoolKeyWithLogger(logger *slog.Logger) (*messaging.Client, error) {
+	logger = loggerOrDiscard(logger)
+
 	key := map[string]interface{}{
 		"type": "external_account",
 		"audience": "//iam.googleapis.com/projects/10207772235/locations/global/workloadIdentityPools/bonito-staging-fcm/providers/bonito-staging-fcm-aws",
@@ -95,28 +133,26 @@ func AuthorizeAndGetfcmClientFromIdPoolKey() (*messaging.Client, error) {
 	gcpCredentials, err := json.Marshal(key)
 
 	if err != nil {
-		logging.Log.Infof("AuthorizeAndGetfcmClientFromKey: Error marshalling key: %s", err)
+		logger.Error("error marshalling the id pool key", "error", err)
 		return nil, err
 	}
 
 	opts := []option.ClientOption{option.WithCredentialsJSON(gcpCredentials)}
 
 	projectId := os.Getenv("GCP_PROD_PROJECT_ID")
-	logging.Log.Infof("AuthorizeAndGetfcmClientFromKey: Initializing firebase app with project ID: %s", projectId)
+	logger.Debug("initializing firebase app", "project_id", projectId)
 	firebaseApp, err := firebaseNewApp(context.Background(), nil, opts...)
 
 	if err != nil {
-		logging.Log.Infof("AuthorizeAndGetfcmClientFromKey: Error initializing firebase app: %s", err)
+		logger.Error("error initializing firebase app", "error", err)
 		return nil, err
 	}
-	logging.Log.Infof("App: %s", firebaseApp)
 
 	fcmClient, err := firebaseApp.Messaging(context.Background())
 	if err != nil {
-		logging.Log.Infof("AuthorizeAndGetfcmClientFromKey: Error initializing FCM client: %s", err)
+		logger.Error("error initializing FCM client", "error", err)
 		return nil, err
 	}
-	logging.Log.Infof("AuthorizeAndGetfcmClientFromKey: FCM Client: %v", fcmClient)
 
 	return fcmClient, err
 }
\ No newline at end of file
@@ -1,13 +1,13 @@
 package utils
 
 import (
+	"bytes"
 	"context"
 	"fmt"
-	"os"
+	"log/slog"
 	"testing"
 
 	firebase "firebase.google.com/go/v4"
-	logging "github.com/fishbrain/logging-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"google.golang.org/api/option"
@@ -22,11 +22,6 @@ type MockFirebaseApp struct {
 	mock.Mock
 }
 
-func TestMain(m *testing.M) {
-	logging.Init(logging.LoggingConfig{})
-	os.Exit(m.Run())
-}
-
 func TestAuthorizeAndGetFirebaseMessagingClient_ErrorInitializingFirebaseApp(t *testing.T) {
 
 	// Mock firebase.NewApp to return an error
@@ -51,4 +46,19 @@ func TestAuthorizeAndGetFirebaseMessagingClient_ErrorInitializingFCMClient(t *te
 
 	_, err := AuthorizeAndGetFirebaseMessagingClient()
 	assert.Error(t, err)
-}
\ No newline at end of file
+}
+
+func TestAuthorizeAndGetFirebaseMessagingClientWithLogger_LogsErrors(t *testing.T) {
+	firebaseNewApp = func(ctx context.Context, config *firebase.Config, opts ...option.ClientOption) (*firebase.App, error) {
+		return nil, fmt.Errorf("error initializing firebase app")
+	}
+	defer func() { firebaseNewApp = firebase.NewApp }()
+
+	var out bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	_, err := AuthorizeAndGetFirebaseMessagingClientWithLogger(logger)
+	assert.Error(t, err)
+	assert.Contains(t, out.String(), "level=DEBUG msg=\"initializing firebase app\"")
+	assert.Contains(t, out.String(), "level=ERROR msg=\"error initializing firebase app\"")
+}
@@ -0,0 +1,265 @@
+package fcm
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// colorPattern notification colours, #rrggbb
+	colorPattern = regexp.MustCompile("^#[0-9a-fA-F]{6}$")
+)
+
+// FieldError a single validation rule violated by a message field
+type FieldError struct {
+	// Field path of the field, e.g. "notification.color"
+	Field   string
+	Message string
+	// Err the typed error behind the violation, if any
+	Err error
+}
+
+// Error formats the field path and message
+func (this *FieldError) Error() string {
+	return this.Field + ": " + this.Message
+}
+
+// Unwrap the typed error behind the violation
+func (this *FieldError) Unwrap() error {
+	return this.Err
+}
+
+// ValidationError every validation rule violated by a message
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+// Error lists every violation
+func (this *ValidationError) Error() string {
+	messages := make([]string, 0, len(this.Errors))
+	for _, err := range this.Errors {
+		messages = append(messages, err.Error())
+	}
+
+	return "fcm: invalid message: " + strings.Join(messages, "; ")
+}
+
+// Unwrap the violations, for errors.Is and errors.As
+func (this *ValidationError) Unwrap() []error {
+	result := make([]error, 0, len(this.Errors))
+	for _, err := range this.Errors {
+		result = append(result, err)
+	}
+
+	return result
+}
+
+// validator collects the violations of a message
+type validator struct {
+	errors []*FieldError
+}
+
+// add records a violation
+func (this *validator) add(field string, format string, args ...interface{}) {
+	this.errors = append(this.errors, &FieldError{
+		Field:   field,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// addErr records a violation caused by err
+func (this *validator) addErr(field string, err error) {
+	this.errors = append(this.errors, &FieldError{
+		Field:   field,
+		Message: strings.TrimPrefix(err.Error(), "fcm: "),
+		Err:     err,
+	})
+}
+
+// err returns a *ValidationError, nil when no rule was violated
+func (this *validator) err() error {
+	if len(this.errors) == 0 {
+		return nil
+	}
+
+	return &ValidationError{Errors: this.errors}
+}
+
+// Validate runs every validation rule on the message, returning a
+// *ValidationError listing all the violations, or nil when it is valid
+func (this *FcmMsg) Validate() error {
+	v := new(validator)
+
+	this.validateTarget(v)
+
+	if this.Priority != "" && this.Priority != Priority_HIGH && this.Priority != Priority_NORMAL {
+		v.add("priority", "unknown priority %q, expected %q or %q", this.Priority, Priority_HIGH, Priority_NORMAL)
+	}
+
+	if this.TimeToLive < 0 || this.TimeToLive > MAX_TTL {
+		v.add("time_to_live", "must be between 0 and %d seconds, got %d", MAX_TTL, this.TimeToLive)
+	}
+
+	switch data := this.Data.(type) {
+	case nil, *AppData, AppData, map[string]string:
+	case map[string]interface{}:
+		for _, key := range data_string_fields {
+			if value, ok := data[key]; ok {
+				if _, ok := value.(string); !ok {
+					v.add("data."+key, "must be a string, got %T", value)
+				}
+			}
+		}
+		if badgeCount, ok := data["badge_count"]; ok {
+			if _, ok := badgeCountString(badgeCount); !ok {
+				v.add("data.badge_count", "must be a number, got %v", badgeCount)
+			}
+		}
+	default:
+		v.add("data", "must be a map[string]interface{}, map[string]string or *AppData, got %T", this.Data)
+	}
+
+	if this.Notification != nil {
+		this.Notification.validate(v, "notification")
+	}
+	this.validateActions(v)
+	this.validateAnalyticsLabel(v)
+
+	if this.Sound != nil {
+		this.Sound.validate(v, "sound")
+	}
+
+	if this.APNS != nil {
+		this.APNS.validate(v, "apns")
+	}
+
+	if this.Android != nil {
+		this.Android.validate(v, "android")
+	}
+
+	if this.DeliveryWindow != nil {
+		if err := this.DeliveryWindow.Validate(); err != nil {
+			v.addErr("delivery_window", err)
+		}
+	}
+	for _, timeZone := range this.TimeZones {
+		if _, err := time.LoadLocation(timeZone); err != nil {
+			v.add("time_zones", "unknown time zone %q", timeZone)
+		}
+	}
+
+	if len(v.errors) == 0 {
+		if message, err := this.makeMulticastMessage(); err != nil {
+			v.add("data", "%s", err)
+		} else if err := this.fitPayload(message); err != nil {
+			var tooLarge *PayloadTooLargeError
+			if errors.As(err, &tooLarge) {
+				v.add("data", "%s payload is %d bytes, the limit is %d bytes", tooLarge.Platform, tooLarge.Size, tooLarge.Limit)
+			}
+		}
+	}
+
+	return v.err()
+}
+
+// validateTarget checks the message has exactly one kind of target
+func (this *FcmMsg) validateTarget(v *validator) {
+	targets := 0
+	if this.To != "" {
+		targets++
+	}
+	if len(this.RegistrationIds) > 0 {
+		targets++
+	}
+	if this.Condition != "" {
+		targets++
+	}
+
+	switch {
+	case targets == 0:
+		v.add("to", "message has no target, set one of to, registration_ids or condition")
+	case targets > 1:
+		v.add("to", "only one of to, registration_ids or condition may be set")
+	}
+
+	if err := this.topicError(); err != nil {
+		v.addErr("to", err)
+	}
+	if err := this.idempotencyTargetError(); err != nil {
+		v.addErr("idempotency_key", err)
+	}
+
+	if this.Condition != "" {
+		expr, err := ParseCondition(this.Condition)
+		if err != nil {
+			v.addErr("condition", err)
+		} else if err := expr.Validate(); err != nil {
+			v.errors = append(v.errors, err.(*ValidationError).Errors...)
+		}
+	}
+
+	for i, token := range this.RegistrationIds {
+		if strings.TrimSpace(token) == "" {
+			v.add(fmt.Sprintf("registration_ids[%d]", i), "empty token")
+		}
+	}
+}
+
+// validate checks the notification payload fields
+func (this *NotificationPayload) validate(v *validator, path string) {
+	if this.Color != "" && !colorPattern.MatchString(this.Color) {
+		v.add(path+".color", "must be in #rrggbb format, got %q", this.Color)
+	}
+
+	if this.Image != "" {
+		validateHttpsUrl(v, path+".image", this.Image)
+	}
+
+	if this.Badge != "" {
+		if badge, err := strconv.Atoi(this.Badge); err != nil || badge < 0 {
+			v.add(path+".badge", "must be a non-negative number, got %q", this.Badge)
+		}
+	}
+}
+
+// validateHttpsUrl checks value is an absolute https URL
+func validateHttpsUrl(v *validator, field string, value string) {
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		v.add(field, "must be an https URL, got %q", value)
+	}
+}
+
+// Validate runs every validation rule on the message being built,
+// and checks the client allows its critical sounds
+func (this *FcmClient) Validate() error {
+	err := this.Message.Validate()
+
+	if criticalErr := this.checkCriticalAlerts(&this.Message); criticalErr != nil {
+		v := new(validator)
+		if validationErr, ok := err.(*ValidationError); ok {
+			v.errors = validationErr.Errors
+		}
+		if this.Message.Sound != nil && this.Message.Sound.APNS != nil && this.Message.Sound.APNS.Critical {
+			v.addErr("sound.apns.critical", criticalErr)
+		} else {
+			v.addErr("apns.interruption_level", criticalErr)
+		}
+		return v.err()
+	}
+
+	return err
+}
+
+// SetStrictValidation when enabled Send refuses invalid messages,
+// returning the *ValidationError without sending anything
+func (this *FcmClient) SetStrictValidation(strict bool) *FcmClient {
+	this.StrictValidation = strict
+
+	return this
+}
@@ -0,0 +1,125 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func validationFields(t *testing.T, err error) []string {
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr))
+
+	var fields []string
+	for _, fieldErr := range validationErr.Errors {
+		fields = append(fields, fieldErr.Field)
+	}
+
+	return fields
+}
+
+func TestValidate_Valid(t *testing.T) {
+	msg := FcmMsg{
+		RegistrationIds: []string{"token0"},
+		Priority:        Priority_HIGH,
+		TimeToLive:      3600,
+		Data:            map[string]interface{}{"item_id": "123"},
+		Notification: &NotificationPayload{
+			Title: "title",
+			Color: "#00ff00",
+			Image: "https://example.com/img.jpg",
+			Badge: "3",
+		},
+	}
+
+	require.Nil(t, msg.Validate())
+}
+
+func TestValidate_ReportsEveryViolation(t *testing.T) {
+	msg := FcmMsg{
+		To:              "/topics/news",
+		RegistrationIds: []string{"token0", ""},
+		Priority:        "urgent",
+		TimeToLive:      MAX_TTL + 1,
+		Notification: &NotificationPayload{
+			Color: "green",
+			Image: "http://example.com/img.jpg",
+			Badge: "many",
+		},
+	}
+
+	err := msg.Validate()
+	require.Equal(t, []string{
+		"to",
+		"registration_ids[1]",
+		"priority",
+		"time_to_live",
+		"notification.color",
+		"notification.image",
+		"notification.badge",
+	}, validationFields(t, err))
+
+	var fieldErr *FieldError
+	require.True(t, errors.As(err, &fieldErr))
+	require.Equal(t, "to", fieldErr.Field)
+}
+
+func TestValidate_Condition(t *testing.T) {
+	msg := FcmMsg{Condition: "'a' in topics && 'b' in topics"}
+	require.Nil(t, msg.Validate())
+
+	msg.Condition = "'a' in topics &&"
+	require.Equal(t, []string{"condition"}, validationFields(t, msg.Validate()))
+}
+
+func TestValidate_EmptyTarget(t *testing.T) {
+	msg := FcmMsg{}
+
+	require.Equal(t, []string{"to"}, validationFields(t, msg.Validate()))
+}
+
+func TestSend_StrictValidationRefusesInvalid(t *testing.T) {
+	messagingClientMock := new(fcmMock)
+
+	c := NewFcmClient("key").
+		SetMessagingClient(messagingClientMock).
+		SetStrictValidation(true).
+		SetPriority(Priority_HIGH).
+		SetNotificationPayload(&NotificationPayload{Title: "title", Color: "red"})
+
+	_, err := c.Send()
+	require.Equal(t, []string{"to", "notification.color"}, validationFields(t, err))
+	messagingClientMock.AssertNotCalled(t, "SendEachForMulticast", mock.Anything, mock.Anything)
+}
+
+func TestValidate_DataTypes(t *testing.T) {
+	msg := FcmMsg{
+		RegistrationIds: []string{"token0"},
+		Data:            map[string]interface{}{"title": 5, "item_id": 42, "body": "body"},
+	}
+	require.Equal(t, []string{"data.title", "data.item_id"}, validationFields(t, msg.Validate()))
+
+	messagingClientMock := new(fcmMock)
+	c := NewFcmClient("key").
+		SetMessagingClient(messagingClientMock).
+		NewFcmRegIdsMsg([]string{"token0"}, map[string]interface{}{"title": 5})
+
+	_, err := c.Send()
+	var fieldErr *FieldError
+	require.True(t, errors.As(err, &fieldErr))
+	require.Equal(t, "data.title", fieldErr.Field)
+	require.Equal(t, "must be a string, got int", fieldErr.Message)
+	messagingClientMock.AssertNotCalled(t, "SendEachForMulticast", mock.Anything, mock.Anything)
+
+	_, ok := c.Message.makeMulticastMessageData()
+	require.False(t, ok)
+
+	// the credentials fallback reads the status of a failed send
+	status, err := c.sendOnceContext(context.Background(), messagingClientMock)
+	require.NotNil(t, err)
+	require.NotNil(t, status)
+	require.False(t, status.Ok)
+}